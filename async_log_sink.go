@@ -1,21 +1,17 @@
 package zlog
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/url"
-	"os"
-	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/kyle-hy/zlog/chanmgr"
 	"go.uber.org/zap"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 const (
@@ -39,6 +35,8 @@ type WriteCloseFlusher struct {
 
 // AsyncLogSink 定义一个结构体
 type AsyncLogSink struct {
+	name       string
+	overflow   bool
 	closed     bool
 	failCounts uint64
 	chanMgr    *chanmgr.ChanMgr
@@ -48,42 +46,120 @@ type AsyncLogSink struct {
 	wg         sync.WaitGroup
 }
 
-// AsyncLoggerSink 定义工厂函数
+// AsyncLoggerSink 定义工厂函数, 同一文件路径的输出共用一个异步管道, 见 sharedFileSink
 func AsyncLoggerSink(url *url.URL) (sink zap.Sink, err error) {
-	var writer io.WriteCloser
-	filePath := getLogFilePath(&defaultOptions)
-
-	if defaultOptions.rotate {
-		writer = &lumberjack.Logger{
-			Filename:   filePath,
-			Compress:   true,
-			LocalTime:  true,
-			MaxSize:    maxFileSize,
-			MaxBackups: maxBackups,
-			MaxAge:     maxAge,
-		}
-	} else {
-		err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	cfg, err := asyncConfigFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return openSharedFileSink(loadOptions(), cfg)
+}
+
+var (
+	fileSinksMu sync.Mutex
+	fileSinks   = make(map[string]*sharedFileSink)
+)
+
+// sharedFileSink 一个文件路径的异步文件输出, 由多个logger引用.
+// 重新加载配置时新logger先打开再关闭旧logger, 文件选项不变时共用管道, 管道中的日志不丢失;
+// 选项变化时先写完旧管道再打开新文件, 同一文件不会有两个写入者
+type sharedFileSink struct {
+	path string
+	key  string // 影响文件写入的选项
+	refs int
+
+	mu   sync.RWMutex
+	sink *AsyncLogSink
+}
+
+// fileSinkKey 影响文件写入链的选项
+func fileSinkKey(opt *Options, cfg AsyncConfig) string {
+	return fmt.Sprint(opt.rotate, opt.compress, opt.hashChain, opt.encryptKey, opt.encoding, opt.bufioSize, cfg.Buffer, cfg.Overflow)
+}
+
+func openSharedFileSink(opt *Options, cfg AsyncConfig) (*fileSinkRef, error) {
+	path := getLogFilePath(opt)
+	key := fileSinkKey(opt, cfg)
+
+	fileSinksMu.Lock()
+	defer fileSinksMu.Unlock()
+	s, ok := fileSinks[path]
+	if !ok {
+		wc, err := newFileWriter(opt)
 		if err != nil {
 			return nil, err
 		}
-		openFlag := os.O_CREATE | os.O_WRONLY | os.O_APPEND // 使用第三方程序rotate的话，用append模式打开，否则会形成空洞的大文件
-		writer, err = os.OpenFile(filePath, openFlag, os.FileMode(0644))
+		s = &sharedFileSink{path: path, key: key, sink: newAsyncLogSink(path, wc, cfg)}
+		fileSinks[path] = s
+	} else if s.key != key {
+		// 写入期间阻塞旧logger的写入, 旧管道写完后再打开文件
+		s.mu.Lock()
+		s.sink.Close()
+		wc, err := newFileWriter(opt)
 		if err != nil {
+			s.sink = newAsyncLogSink(path, &WriteCloseFlusher{Writer: io.Discard, Closer: nopCloser{}, Flusher: nopFlusher{}}, cfg)
+			s.mu.Unlock()
 			return nil, err
 		}
+		s.key, s.sink = key, newAsyncLogSink(path, wc, cfg)
+		s.mu.Unlock()
+	}
+	s.refs++
+	return &fileSinkRef{s: s}, nil
+}
+
+func (s *sharedFileSink) release() {
+	fileSinksMu.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last {
+		delete(fileSinks, s.path)
+	}
+	fileSinksMu.Unlock()
+	if last {
+		s.mu.Lock()
+		s.sink.Close()
+		s.mu.Unlock()
 	}
+}
+
+// fileSinkRef 一个logger对共享文件输出的引用, Sync 同 AsyncLogSink 为关闭, 最后一个引用关闭时写完管道
+type fileSinkRef struct {
+	s    *sharedFileSink
+	once sync.Once
+}
+
+func (r *fileSinkRef) Write(p []byte) (n int, err error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.s.sink.Write(p)
+}
 
-	bw := bufio.NewWriterSize(writer, defaultOptions.bufioSize)
-	wc := &WriteCloseFlusher{
-		Writer:  bw,
-		Flusher: bw,
-		Closer:  writer,
+func (r *fileSinkRef) Sync() error {
+	return r.Close()
+}
+
+func (r *fileSinkRef) Close() error {
+	r.once.Do(r.s.release)
+	return nil
+}
+
+// newAsyncLogSink 日志先放入channel缓存, 后台协程读取channel写入writer, name为统计中输出的名字
+func newAsyncLogSink(name string, wc *WriteCloseFlusher, cfg AsyncConfig) *AsyncLogSink {
+	shards := uint64(256)
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = maxChanSize
+	}
+	if uint64(cfg.Buffer) < shards {
+		shards = uint64(cfg.Buffer)
 	}
 	c := &AsyncLogSink{
-		writer:  wc,
-		chanMgr: chanmgr.NewChanMgr(256, maxChanSize/256),
+		name:     name,
+		overflow: cfg.Overflow,
+		writer:   wc,
+		chanMgr:  chanmgr.NewChanMgr(shards, uint64(cfg.Buffer)/shards),
 	}
+	registerSinkStats(c)
 
 	c.ctx, c.cancel = context.WithCancel(context.Background())
 	c.wg.Add(1)
@@ -92,7 +168,7 @@ func AsyncLoggerSink(url *url.URL) (sink zap.Sink, err error) {
 		c.wg.Done()
 	}()
 
-	return c, nil
+	return c
 }
 
 // Sync 定义Sync方法以实现Sink接口
@@ -114,9 +190,19 @@ func (c *AsyncLogSink) Close() error {
 	}
 	c.wg.Wait() // wait until all msgs have been consumed
 	c.writer.Close()
+	unregisterSinkStats(c)
 	return nil
 }
 
+// stats 输出的统计
+func (c *AsyncLogSink) stats() SinkStats {
+	s := SinkStats{Name: c.name, Overflow: atomic.LoadUint64(&c.failCounts)}
+	if dc, ok := c.writer.Writer.(dropCounter); ok {
+		s.Dropped = dc.Dropped()
+	}
+	return s
+}
+
 // 定义Write方法以实现Sink接口
 func (c *AsyncLogSink) Write(p []byte) (n int, err error) {
 	// zap框架复用切片p参数,需要拷贝否则错乱
@@ -124,7 +210,7 @@ func (c *AsyncLogSink) Write(p []byte) (n int, err error) {
 	copy(cp, p)
 
 	msgChan, _ := c.chanMgr.NextWrite()
-	if !defaultOptions.overflow {
+	if !c.overflow {
 		msgChan <- cp
 	} else {
 		select {
@@ -139,10 +225,22 @@ func (c *AsyncLogSink) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// addField 在日志末尾追加一个计数字段, 按内容识别json、GELF、console和二进制编码
 func addField(failCounts uint64, name string, msg []byte) []byte {
-	b := bytes.TrimSuffix(msg, []byte("}\n"))
-	b = append(b, []byte(fmt.Sprintf(",\"%s\":%d}\n", name, failCounts))...)
-	return b
+	if bytes.HasSuffix(msg, []byte("}\n")) {
+		if bytes.Contains(msg, []byte(`"short_message":`)) {
+			name = gelfKey(name)
+		}
+		b := bytes.TrimSuffix(msg, []byte("}\n"))
+		b = append(b, []byte(fmt.Sprintf(",\"%s\":%d}\n", name, failCounts))...)
+		return b
+	}
+	if b := appendBinaryUintField(msg, name, failCounts); len(b) != len(msg) {
+		return b
+	}
+	// console编码没有字段时追加json对象
+	b := bytes.TrimSuffix(msg, []byte("\n"))
+	return append(b, []byte(fmt.Sprintf("\t{\"%s\":%d}\n", name, failCounts))...)
 }
 
 func (c *AsyncLogSink) loop() {
@@ -0,0 +1,113 @@
+package zlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const asyncSchemePrefix = "async+"
+
+// AsyncConfig 异步管道的配置
+type AsyncConfig struct {
+	Buffer   int  // 管道缓存的日志条数, 默认256K
+	Overflow bool // 管道满后丢弃日志并计数, 否则阻塞等待
+}
+
+// asyncConfigFromURL 读取URL参数 buffer=条数、overflow=drop|block, 未设置时使用全局的 Overflow 选项
+func asyncConfigFromURL(u *url.URL) (AsyncConfig, error) {
+	cfg := AsyncConfig{Buffer: maxChanSize, Overflow: loadOptions().overflow}
+	q := u.Query()
+	if v := q.Get("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("zlog: invalid buffer %q", v)
+		}
+		cfg.Buffer = n
+	}
+	switch v := q.Get("overflow"); v {
+	case "":
+	case "drop":
+		cfg.Overflow = true
+	case "block":
+		cfg.Overflow = false
+	default:
+		return cfg, fmt.Errorf("zlog: invalid overflow %q, want drop or block", v)
+	}
+	return cfg, nil
+}
+
+// NewAsyncSink 在任意io.Writer前加异步管道, 每条日志调用一次w.Write.
+// w 实现 Flush() error 时在管道空闲时调用, 实现 io.Closer 时在关闭时调用, Sync 会写完剩余日志并关闭.
+// name 为 Stats 中输出的名字
+func NewAsyncSink(name string, w io.Writer, cfg AsyncConfig) *AsyncLogSink {
+	wc := &WriteCloseFlusher{Writer: w, Closer: nopCloser{}, Flusher: nopFlusher{}}
+	if f, ok := w.(Flusher); ok {
+		wc.Flusher = f
+	}
+	if c, ok := w.(io.Closer); ok {
+		wc.Closer = c
+	}
+	return newAsyncLogSink(name, wc, cfg)
+}
+
+// RegisterAsyncScheme 为已注册到zap的sink注册 async+scheme, 如 async+kafka://,
+// stdout、stderr、file 和本库的sink已内置
+func RegisterAsyncScheme(scheme string) error {
+	return zap.RegisterSink(asyncSchemePrefix+scheme, asyncSink)
+}
+
+// asyncSink 定义工厂函数, 在任意zap sink前加异步管道, URL格式:
+//
+//	async+stdout://?buffer=1024&overflow=drop
+//	async+file:///var/log/x.log
+//	async+<scheme>://...  其余参数交给内层sink
+//
+// 内层sink为字节流, 日志经bufio合并后写入, 管道空闲时Flush
+func asyncSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := asyncConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := *u
+	inner.Scheme = strings.TrimPrefix(u.Scheme, asyncSchemePrefix)
+	q := inner.Query()
+	q.Del("buffer")
+	q.Del("overflow")
+	inner.RawQuery = q.Encode()
+	target := inner.String()
+	if inner.Scheme == "stdout" || inner.Scheme == "stderr" {
+		target = inner.Scheme // zap按路径名识别标准输出
+	}
+
+	ws, closeInner, err := zap.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriterSize(ws, loadOptions().bufioSize)
+	closer := closerFunc(func() error {
+		err := bw.Flush()
+		ws.Sync()
+		closeInner()
+		return err
+	})
+	return newAsyncLogSink(u.Redacted(), &WriteCloseFlusher{Writer: bw, Closer: closer, Flusher: bw}, cfg), nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+type nopFlusher struct{}
+
+func (nopFlusher) Flush() error { return nil }
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
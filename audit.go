@@ -0,0 +1,104 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultAuditPath = "./log/%s/%s.audit.log"
+	auditLoggerName  = "audit"
+)
+
+var (
+	errAuditNotInit = errors.New("zlog: audit log not init")
+	errAuditClosed  = errors.New("zlog: audit log closed")
+)
+
+// AuditLogger 审计日志
+// 与应用日志共用Options和编码配置, 但不经过异步管道:
+// 每条日志同步写入独立文件并fsync落盘后才返回, 写失败把错误返回给调用方, 不会因管道溢出被丢弃
+type AuditLogger struct {
+	mu   sync.Mutex
+	enc  zapcore.Encoder
+	file *os.File
+}
+
+// 审计日志文件路径, 默认与应用日志同目录
+func getAuditFilePath(opt *Options) string {
+	if len(opt.auditPath) == 0 {
+		return fmt.Sprintf(defaultAuditPath, processName(), processName())
+	}
+	return opt.auditPath
+}
+
+// newAuditLogger 创建审计日志
+func newAuditLogger(opt *Options) (*AuditLogger, error) {
+	filePath := getAuditFilePath(opt)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.FileMode(0644))
+	if err != nil {
+		return nil, err
+	}
+
+	enc := zapcore.NewJSONEncoder(newEncoderConfig(opt.k8sKeys))
+	for k, v := range opt.fields {
+		zap.Any(k, v).AddTo(enc)
+	}
+	return &AuditLogger{enc: enc, file: file}, nil
+}
+
+// Log 写一条审计日志, fsync落盘后返回
+func (a *AuditLogger) Log(msg string, fields ...zapcore.Field) error {
+	return a.log(2, msg, fields)
+}
+
+// Close 关闭审计日志文件
+func (a *AuditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// skip 为调用方相对log函数的栈深度
+func (a *AuditLogger) log(skip int, msg string, fields []zapcore.Field) error {
+	ent := zapcore.Entry{
+		LoggerName: auditLoggerName,
+		Level:      zap.InfoLevel,
+		Time:       time.Now(),
+		Message:    msg,
+		Caller:     zapcore.NewEntryCaller(runtime.Caller(skip)),
+	}
+	buf, err := a.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return errAuditClosed
+	}
+	if _, err := a.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
@@ -0,0 +1,297 @@
+package zlog
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// BinaryEncoding 紧凑二进制日志编码的名字, zap.Config.Encoding 使用
+const BinaryEncoding = "zbin"
+
+// 二进制日志格式, 每条记录为 uvarint(长度) | 类型(1字节) | 内容, 字符串为 uvarint(长度) | 字节
+//
+//	H 文件头: magic, 清空key字典. 每个文件开头和字典写满时写出
+//	K key定义: uvarint(id) | key
+//	E 日志: varint(unix纳秒) | level | logger名 | msg | caller | stack | 字段... | 0
+//	e 同E, 字段key为字符串而不是字典id, 编码器输出此格式, 写文件时转换为E
+//
+// 字段为 类型(1字节) | key | 值, 整数使用varint
+const (
+	binRecordHeader    byte = 'H'
+	binRecordKey       byte = 'K'
+	binRecordEntry     byte = 'E'
+	binRecordEntryKeys byte = 'e'
+)
+
+// 字段类型
+const (
+	binFieldEnd       byte = iota // 字段结束
+	binFieldString                // 字符串
+	binFieldInt                   // 有符号整数 varint
+	binFieldUint                  // 无符号整数 uvarint
+	binFieldFloat                 // float64 8字节小端
+	binFieldBool                  // bool 1字节
+	binFieldBinary                // 二进制
+	binFieldDuration              // time.Duration varint纳秒
+	binFieldTime                  // time.Time varint unix纳秒
+	binFieldJSON                  // 数组、对象等嵌套值, json
+	binFieldComplex               // complex128 实部、虚部各8字节
+	binFieldNamespace             // 之后的字段都放到该key的对象中
+)
+
+var binaryMagic = []byte("ZLB1")
+
+var binaryPool = buffer.NewPool()
+
+func init() {
+	if err := zap.RegisterEncoder(BinaryEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newBinaryEncoder(), nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// binaryEncoder 紧凑二进制日志编码器, 带类型的字段, 整数使用varint
+type binaryEncoder struct {
+	buf []byte // With添加的字段
+}
+
+func newBinaryEncoder() *binaryEncoder {
+	return &binaryEncoder{}
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	return appendUvarint(b, uint64(v<<1)^uint64(v>>63))
+}
+
+func appendBinString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	v := math.Float64bits(f)
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24), byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+func (e *binaryEncoder) field(typ byte, key string) {
+	e.buf = append(e.buf, typ)
+	e.buf = appendBinString(e.buf, key)
+}
+
+// AddArray 嵌套数组编码为json
+func (e *binaryEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	if err := m.AddArray(key, marshaler); err != nil {
+		return err
+	}
+	return e.AddReflected(key, m.Fields[key])
+}
+
+// AddObject 嵌套对象编码为json
+func (e *binaryEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	if err := m.AddObject(key, marshaler); err != nil {
+		return err
+	}
+	return e.AddReflected(key, m.Fields[key])
+}
+
+// AddBinary .
+func (e *binaryEncoder) AddBinary(key string, value []byte) {
+	e.field(binFieldBinary, key)
+	e.buf = appendUvarint(e.buf, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+// AddByteString .
+func (e *binaryEncoder) AddByteString(key string, value []byte) {
+	e.field(binFieldString, key)
+	e.buf = appendUvarint(e.buf, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+// AddBool .
+func (e *binaryEncoder) AddBool(key string, value bool) {
+	e.field(binFieldBool, key)
+	if value {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// AddComplex128 .
+func (e *binaryEncoder) AddComplex128(key string, value complex128) {
+	e.field(binFieldComplex, key)
+	e.buf = appendFloat(e.buf, real(value))
+	e.buf = appendFloat(e.buf, imag(value))
+}
+
+// AddComplex64 .
+func (e *binaryEncoder) AddComplex64(key string, value complex64) {
+	e.AddComplex128(key, complex128(value))
+}
+
+// AddDuration .
+func (e *binaryEncoder) AddDuration(key string, value time.Duration) {
+	e.field(binFieldDuration, key)
+	e.buf = appendVarint(e.buf, int64(value))
+}
+
+// AddFloat64 .
+func (e *binaryEncoder) AddFloat64(key string, value float64) {
+	e.field(binFieldFloat, key)
+	e.buf = appendFloat(e.buf, value)
+}
+
+// AddFloat32 .
+func (e *binaryEncoder) AddFloat32(key string, value float32) {
+	e.AddFloat64(key, float64(value))
+}
+
+// AddInt .
+func (e *binaryEncoder) AddInt(key string, value int) { e.AddInt64(key, int64(value)) }
+
+// AddInt64 .
+func (e *binaryEncoder) AddInt64(key string, value int64) {
+	e.field(binFieldInt, key)
+	e.buf = appendVarint(e.buf, value)
+}
+
+// AddInt32 .
+func (e *binaryEncoder) AddInt32(key string, value int32) { e.AddInt64(key, int64(value)) }
+
+// AddInt16 .
+func (e *binaryEncoder) AddInt16(key string, value int16) { e.AddInt64(key, int64(value)) }
+
+// AddInt8 .
+func (e *binaryEncoder) AddInt8(key string, value int8) { e.AddInt64(key, int64(value)) }
+
+// AddString .
+func (e *binaryEncoder) AddString(key, value string) {
+	e.field(binFieldString, key)
+	e.buf = appendBinString(e.buf, value)
+}
+
+// AddTime .
+func (e *binaryEncoder) AddTime(key string, value time.Time) {
+	e.field(binFieldTime, key)
+	e.buf = appendVarint(e.buf, value.UnixNano())
+}
+
+// AddUint .
+func (e *binaryEncoder) AddUint(key string, value uint) { e.AddUint64(key, uint64(value)) }
+
+// AddUint64 .
+func (e *binaryEncoder) AddUint64(key string, value uint64) {
+	e.field(binFieldUint, key)
+	e.buf = appendUvarint(e.buf, value)
+}
+
+// AddUint32 .
+func (e *binaryEncoder) AddUint32(key string, value uint32) { e.AddUint64(key, uint64(value)) }
+
+// AddUint16 .
+func (e *binaryEncoder) AddUint16(key string, value uint16) { e.AddUint64(key, uint64(value)) }
+
+// AddUint8 .
+func (e *binaryEncoder) AddUint8(key string, value uint8) { e.AddUint64(key, uint64(value)) }
+
+// AddUintptr .
+func (e *binaryEncoder) AddUintptr(key string, value uintptr) { e.AddUint64(key, uint64(value)) }
+
+// AddReflected 任意值编码为json
+func (e *binaryEncoder) AddReflected(key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	e.field(binFieldJSON, key)
+	e.buf = appendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+// OpenNamespace .
+func (e *binaryEncoder) OpenNamespace(key string) {
+	e.field(binFieldNamespace, key)
+}
+
+// Clone .
+func (e *binaryEncoder) Clone() zapcore.Encoder {
+	return &binaryEncoder{buf: append([]byte(nil), e.buf...)}
+}
+
+// EncodeEntry 编码一条日志记录, 字段key为字符串
+func (e *binaryEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := &binaryEncoder{buf: make([]byte, 0, 256)}
+	final.buf = append(final.buf, binRecordEntryKeys)
+	final.buf = appendVarint(final.buf, ent.Time.UnixNano())
+	final.buf = append(final.buf, byte(ent.Level))
+	final.buf = appendBinString(final.buf, ent.LoggerName)
+	final.buf = appendBinString(final.buf, ent.Message)
+	caller := ""
+	if ent.Caller.Defined {
+		caller = callerString(ent.Caller)
+	}
+	final.buf = appendBinString(final.buf, caller)
+	final.buf = appendBinString(final.buf, ent.Stack)
+
+	final.buf = append(final.buf, e.buf...)
+	for _, f := range fields {
+		f.AddTo(final)
+	}
+	final.buf = append(final.buf, binFieldEnd)
+
+	out := binaryPool.Get()
+	out.Write(appendUvarint(nil, uint64(len(final.buf))))
+	out.Write(final.buf)
+	return out, nil
+}
+
+// appendBinaryUintField 在编码好的日志记录末尾追加一个无符号整数字段
+func appendBinaryUintField(rec []byte, key string, v uint64) []byte {
+	size, n := uvarint(rec)
+	if n <= 0 || uint64(len(rec)-n) != size || size == 0 || rec[len(rec)-1] != binFieldEnd {
+		return rec
+	}
+	body := append([]byte(nil), rec[n:len(rec)-1]...)
+	body = append(body, binFieldUint)
+	body = appendBinString(body, key)
+	body = appendUvarint(body, v)
+	body = append(body, binFieldEnd)
+
+	out := appendUvarint(make([]byte, 0, len(body)+4), uint64(len(body)))
+	return append(out, body...)
+}
+
+// uvarint 解析uvarint, n<=0表示数据不完整或溢出
+func uvarint(b []byte) (uint64, int) {
+	var v uint64
+	var s uint
+	for i, c := range b {
+		if i == 10 {
+			return 0, -1
+		}
+		if c < 0x80 {
+			return v | uint64(c)<<s, i + 1
+		}
+		v |= uint64(c&0x7f) << s
+		s += 7
+	}
+	return 0, 0
+}
@@ -0,0 +1,369 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	maxBinaryKeys   = 4096             // key字典上限, 写满后写出新的文件头重建字典
+	maxBinaryRecord = 64 * 1024 * 1024 // 单条记录的最大长度
+)
+
+var errBinaryCorrupt = errors.New("zlog: corrupt binary record")
+
+// binReader 解析二进制记录
+type binReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *binReader) fail() {
+	if r.err == nil {
+		r.err = errBinaryCorrupt
+	}
+}
+
+func (r *binReader) byte() byte {
+	if r.err != nil || r.pos >= len(r.b) {
+		r.fail()
+		return 0
+	}
+	c := r.b[r.pos]
+	r.pos++
+	return c
+}
+
+func (r *binReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *binReader) bytes(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.b)-r.pos) {
+		r.fail()
+		return nil
+	}
+	b := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *binReader) str() []byte {
+	return r.bytes(r.uvarint())
+}
+
+func (r *binReader) float() float64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56)
+}
+
+// skipEntryHeader 跳过日志记录的固定部分: 时间、level、logger名、msg、caller、stack
+func (r *binReader) skipEntryHeader() {
+	r.varint()
+	r.byte()
+	for i := 0; i < 4; i++ {
+		r.str()
+	}
+}
+
+// value 读取一个字段值的原始字节
+func (r *binReader) value(typ byte) []byte {
+	start := r.pos
+	switch typ {
+	case binFieldString, binFieldBinary, binFieldJSON:
+		r.str()
+	case binFieldInt, binFieldUint, binFieldDuration, binFieldTime:
+		r.uvarint()
+	case binFieldFloat:
+		r.bytes(8)
+	case binFieldBool:
+		r.bytes(1)
+	case binFieldComplex:
+		r.bytes(16)
+	case binFieldNamespace:
+	default:
+		r.fail()
+	}
+	if r.err != nil {
+		return nil
+	}
+	return r.b[start:r.pos]
+}
+
+func appendBinRecord(b []byte, body []byte) []byte {
+	b = appendUvarint(b, uint64(len(body)))
+	return append(b, body...)
+}
+
+// binaryDictWriter 二进制日志写文件前把字段key换成文件内的字典id
+// 每个文件以文件头开始, 滚动后在新文件重建字典, 每个文件可以独立解码
+type binaryDictWriter struct {
+	w          io.Writer
+	keys       map[string]uint64
+	needHeader bool
+	body       []byte
+	out        []byte
+}
+
+func newBinaryDictWriter(w io.Writer) *binaryDictWriter {
+	return &binaryDictWriter{w: w, needHeader: true}
+}
+
+// Write p 为一条编码器输出的完整记录
+func (d *binaryDictWriter) Write(p []byte) (n int, err error) {
+	size, n := uvarint(p)
+	if n <= 0 || uint64(len(p)-n) != size || size == 0 || p[n] != binRecordEntryKeys {
+		return d.w.Write(p)
+	}
+
+	d.out = d.out[:0]
+	if d.needHeader || len(d.keys) >= maxBinaryKeys {
+		d.out = appendBinRecord(d.out, append([]byte{binRecordHeader}, binaryMagic...))
+		d.keys = make(map[string]uint64)
+		d.needHeader = false
+	}
+
+	r := &binReader{b: p[n+1:]}
+	r.skipEntryHeader()
+	d.body = append(d.body[:0], binRecordEntry)
+	d.body = append(d.body, r.b[:r.pos]...)
+	for r.err == nil {
+		typ := r.byte()
+		if typ == binFieldEnd {
+			break
+		}
+		key := r.str()
+		raw := r.value(typ)
+
+		id, ok := d.keys[string(key)]
+		if !ok {
+			id = uint64(len(d.keys))
+			d.keys[string(key)] = id
+			def := appendUvarint([]byte{binRecordKey}, id)
+			d.out = appendBinRecord(d.out, append(def, key...))
+		}
+		d.body = append(d.body, typ)
+		d.body = appendUvarint(d.body, id)
+		d.body = append(d.body, raw...)
+	}
+	if r.err != nil {
+		d.needHeader = true // 字典中可能有未写出定义的key, 重建字典
+		return 0, r.err
+	}
+	d.body = append(d.body, binFieldEnd)
+	d.out = appendBinRecord(d.out, d.body)
+
+	if _, err := d.w.Write(d.out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush 记录直接写出, 无缓存
+func (d *binaryDictWriter) Flush() error { return nil }
+
+func (d *binaryDictWriter) finish() error { return nil }
+
+// restart 新文件重新写文件头和字典
+func (d *binaryDictWriter) restart() {
+	d.needHeader = true
+}
+
+// DecodeBinaryLog 把二进制日志解码为json行写到w.
+// 每个文件独立解码, 文件尾部不完整的记录(如正在写入或进程崩溃)返回包装 ErrLogUnfinished 的错误, 之前的记录已全部写出.
+func DecodeBinaryLog(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	cfg := newEncoderConfig(false)
+	cfg.EncodeCaller = func(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(caller.File)
+	}
+	enc := zapcore.NewJSONEncoder(cfg)
+
+	var (
+		offset int64
+		dict   = make(map[uint64]string)
+		body   []byte
+	)
+	for {
+		size, err := readUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return binaryReadError(err, offset)
+		}
+		if size == 0 || size > maxBinaryRecord {
+			return fmt.Errorf("%w at offset %d", errBinaryCorrupt, offset)
+		}
+		if uint64(cap(body)) < size {
+			body = make([]byte, size)
+		}
+		body = body[:size]
+		if _, err := io.ReadFull(br, body); err != nil {
+			return binaryReadError(err, offset)
+		}
+
+		switch body[0] {
+		case binRecordHeader:
+			if !bytes.Equal(body[1:], binaryMagic) {
+				return fmt.Errorf("%w at offset %d: bad header", errBinaryCorrupt, offset)
+			}
+			dict = make(map[uint64]string)
+		case binRecordKey:
+			r := &binReader{b: body[1:]}
+			id := r.uvarint()
+			if r.err != nil {
+				return fmt.Errorf("%w at offset %d", r.err, offset)
+			}
+			dict[id] = string(r.b[r.pos:])
+		case binRecordEntry, binRecordEntryKeys:
+			ent, fields, err := decodeBinaryEntry(body, dict)
+			if err != nil {
+				return fmt.Errorf("%w at offset %d", err, offset)
+			}
+			buf, err := enc.EncodeEntry(ent, fields)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(buf.Bytes())
+			buf.Free()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w at offset %d: unknown record type %q", errBinaryCorrupt, offset, body[0])
+		}
+		offset += int64(len(appendUvarint(nil, size))) + int64(size)
+	}
+}
+
+// binaryReadError 文件在记录中间结束时返回包装 ErrLogUnfinished 的错误
+func binaryReadError(err error, offset int64) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated record at offset %d", ErrLogUnfinished, offset)
+	}
+	if errors.Is(err, ErrLogUnfinished) || errors.Is(err, errBinaryCorrupt) {
+		return fmt.Errorf("%w at offset %d", err, offset)
+	}
+	return err
+}
+
+// readUvarint 读取记录长度, 记录边界处的EOF返回io.EOF
+func readUvarint(br *bufio.Reader) (uint64, error) {
+	var v uint64
+	var s uint
+	for i := 0; i < 10; i++ {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if c < 0x80 {
+			return v | uint64(c)<<s, nil
+		}
+		v |= uint64(c&0x7f) << s
+		s += 7
+	}
+	return 0, errBinaryCorrupt
+}
+
+// decodeBinaryEntry 解码一条日志记录
+func decodeBinaryEntry(body []byte, dict map[uint64]string) (zapcore.Entry, []zapcore.Field, error) {
+	inlineKeys := body[0] == binRecordEntryKeys
+	r := &binReader{b: body[1:]}
+
+	var ent zapcore.Entry
+	ent.Time = time.Unix(0, r.varint())
+	ent.Level = zapcore.Level(int8(r.byte()))
+	ent.LoggerName = string(r.str())
+	ent.Message = string(r.str())
+	if caller := r.str(); len(caller) > 0 {
+		ent.Caller = zapcore.EntryCaller{Defined: true, File: string(caller)}
+	}
+	ent.Stack = string(r.str())
+
+	var fields []zapcore.Field
+	for r.err == nil {
+		typ := r.byte()
+		if typ == binFieldEnd {
+			break
+		}
+		var key string
+		if inlineKeys {
+			key = string(r.str())
+		} else {
+			id := r.uvarint()
+			k, ok := dict[id]
+			if !ok && r.err == nil {
+				return ent, nil, fmt.Errorf("%w: undefined key id %d", errBinaryCorrupt, id)
+			}
+			key = k
+		}
+
+		switch typ {
+		case binFieldString:
+			fields = append(fields, zap.String(key, string(r.str())))
+		case binFieldInt:
+			fields = append(fields, zap.Int64(key, r.varint()))
+		case binFieldUint:
+			fields = append(fields, zap.Uint64(key, r.uvarint()))
+		case binFieldFloat:
+			fields = append(fields, zap.Float64(key, r.float()))
+		case binFieldBool:
+			fields = append(fields, zap.Bool(key, r.byte() != 0))
+		case binFieldBinary:
+			fields = append(fields, zap.Binary(key, append([]byte(nil), r.str()...)))
+		case binFieldDuration:
+			fields = append(fields, zap.Duration(key, time.Duration(r.varint())))
+		case binFieldTime:
+			fields = append(fields, zap.Time(key, time.Unix(0, r.varint())))
+		case binFieldJSON:
+			fields = append(fields, zap.Reflect(key, rawJSON(r.str())))
+		case binFieldComplex:
+			re := r.float()
+			fields = append(fields, zap.Complex128(key, complex(re, r.float())))
+		case binFieldNamespace:
+			fields = append(fields, zap.Namespace(key))
+		default:
+			r.fail()
+		}
+	}
+	return ent, fields, r.err
+}
+
+// rawJSON 原样输出的json
+type rawJSON []byte
+
+// MarshalJSON .
+func (j rawJSON) MarshalJSON() ([]byte, error) {
+	return j, nil
+}
@@ -0,0 +1,88 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// encodeBinaryLog 按文件写入链编码日志, 第i条的msg为msgs[i]
+func encodeBinaryLog(t *testing.T, msgs ...string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	dw := newBinaryDictWriter(&out)
+	enc := newBinaryEncoder()
+	for i, msg := range msgs {
+		ent := zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), Message: msg}
+		buf, err := enc.EncodeEntry(ent, []zapcore.Field{zap.Int("n", i), zap.String("room", "r1"), zap.Bool("ok", true)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dw.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		buf.Free()
+	}
+	return out.Bytes()
+}
+
+func decodedLines(t *testing.T, b []byte) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		var m map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("%q: %v", sc.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestBinaryLogRoundTrip(t *testing.T) {
+	data := encodeBinaryLog(t, "enter room", "leave room")
+	var out bytes.Buffer
+	if err := DecodeBinaryLog(bytes.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := decodedLines(t, out.Bytes())
+	if len(lines) != 2 {
+		t.Fatalf("decoded %d lines: %s", len(lines), out.String())
+	}
+	for i, want := range []string{"enter room", "leave room"} {
+		l := lines[i]
+		if l["msg"] != want || l["level"] != "warn" || l["n"] != float64(i) || l["room"] != "r1" || l["ok"] != true {
+			t.Errorf("line %d: %v", i, l)
+		}
+	}
+}
+
+// 进程崩溃时最后一条记录只写了一部分, 之前的记录正常输出
+func TestBinaryLogTruncatedTail(t *testing.T) {
+	data := encodeBinaryLog(t, "enter room", "leave room")
+	for _, cut := range []int{1, 5} {
+		var out bytes.Buffer
+		err := DecodeBinaryLog(bytes.NewReader(data[:len(data)-cut]), &out)
+		if !errors.Is(err, ErrLogUnfinished) {
+			t.Fatalf("cut %d: err = %v, want ErrLogUnfinished", cut, err)
+		}
+		lines := decodedLines(t, out.Bytes())
+		if len(lines) != 1 || lines[0]["msg"] != "enter room" {
+			t.Errorf("cut %d: decoded %s", cut, out.String())
+		}
+	}
+
+	// 记录中间的损坏不是未写完
+	bad := append([]byte(nil), data...)
+	bad[0] = 0
+	if err := DecodeBinaryLog(bytes.NewReader(bad), &bytes.Buffer{}); err == nil || errors.Is(err, ErrLogUnfinished) {
+		t.Errorf("corrupt header: err = %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/kyle-hy/zlog"
+)
+
+func runDecode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	kf := addKeyFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("decode: no log files")
+	}
+	key, err := kf.key()
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, path := range fs.Args() {
+		if err := decodeFile(out, path, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeFile 把二进制日志文件解码为json行写到out
+func decodeFile(out *bufio.Writer, path string, key []byte) error {
+	r, err := zlog.OpenLogFile(path, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := zlog.DecodeBinaryLog(r, out); err != nil {
+		return unfinishedWarning(out, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kyle-hy/zlog"
+)
+
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	kf := addKeyFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("decrypt: no log files")
+	}
+	key, err := kf.key()
+	if err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return errors.New("decrypt: -key or -keyfile required")
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, path := range fs.Args() {
+		if err := catFile(out, path, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCat(args []string) error {
+	fs := flag.NewFlagSet("cat", flag.ExitOnError)
+	kf := addKeyFlags(fs)
+	fs.Parse(args)
+	key, err := kf.key()
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, path := range fs.Args() {
+		if err := catFile(out, path, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unfinishedWarning 未写完的日志文件(正在写入、崩溃或被截断)先输出之前的全部内容再提示, 不报错
+func unfinishedWarning(out *bufio.Writer, path string, err error) error {
+	if errors.Is(err, zlog.ErrLogUnfinished) {
+		out.Flush()
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", path, err)
+		return nil
+	}
+	return errors.New(path + ": " + err.Error())
+}
+
+// catFile 把日志文件解码后的明文写到w
+func catFile(w *bufio.Writer, path string, key []byte) error {
+	r, err := zlog.OpenLogFile(path, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return unfinishedWarning(w, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"os"
+	"strings"
+)
+
+// keyFlags 加密日志文件的密钥参数
+type keyFlags struct {
+	hexKey  string
+	keyFile string
+}
+
+func addKeyFlags(fs *flag.FlagSet) *keyFlags {
+	k := &keyFlags{}
+	fs.StringVar(&k.hexKey, "key", "", "十六进制的AES密钥")
+	fs.StringVar(&k.keyFile, "keyfile", "", "AES密钥文件, 内容为原始密钥字节")
+	return k
+}
+
+// key 解析密钥, 未指定返回nil
+func (k *keyFlags) key() ([]byte, error) {
+	if k.keyFile != "" {
+		return os.ReadFile(k.keyFile)
+	}
+	if k.hexKey != "" {
+		return hex.DecodeString(strings.TrimSpace(k.hexKey))
+	}
+	return nil, nil
+}
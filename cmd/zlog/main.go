@@ -0,0 +1,54 @@
+// zlog 日志文件配套工具
+//
+//	zlog verify [-key hex] [-from seq] [file...]   校验日志文件的防篡改哈希链
+//	zlog decrypt -key hex [file...]    解密日志文件, 输出明文json行
+//	zlog cat [-key hex] [file...]      输出日志文件的明文, 自动解压、解密
+//	zlog decode [-key hex] [file...]   二进制日志文件转换为json行
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command 子命令
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"verify":  {usage: "verify [-key hex] [-from seq] [file...]  校验日志文件(可以是gzip滚动文件)的哈希链, 输出第一个断开的链接", run: runVerify},
+	"decrypt": {usage: "decrypt -key hex|-keyfile path [file...]  解密日志文件, 输出明文json行", run: runDecrypt},
+	"decode":  {usage: "decode [-key hex] [file...]  二进制编码(zbin)的日志文件转换为json行", run: runDecode},
+	"cat":     {usage: "cat [-key hex] [file...]  输出日志文件的明文, 自动识别gzip滚动文件、流式压缩文件和加密文件", run: runCat},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: zlog <command> [arguments]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  zlog", commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "zlog:", err)
+		os.Exit(1)
+	}
+}
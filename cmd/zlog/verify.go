@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/kyle-hy/zlog"
+)
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	kf := addKeyFlags(fs)
+	from := fs.Uint64("from", 1, "链的起始序号, 较早的滚动文件已删除时使用")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("verify: no log files")
+	}
+	key, err := kf.key()
+	if err != nil {
+		return err
+	}
+
+	brk, err := zlog.VerifyHashChainFrom(fs.Args(), key, *from)
+	if err != nil {
+		return err
+	}
+	if brk != nil {
+		return brk
+	}
+	fmt.Printf("ok: %d files verified from seq %d\n", fs.NArg(), *from)
+	return nil
+}
@@ -0,0 +1,47 @@
+// zlogcollect 共享内存日志环的收集进程, 读取进程通过 shm:// 输出写入的日志, 写入滚动文件.
+// 生产者进程崩溃后, 已写入日志环的日志仍由zlogcollect写完. 一个日志环只有一个生产者和一个收集进程,
+// 同一程序的多个实例使用不同的日志环路径, 每个路径运行一个zlogcollect.
+//
+//	zlogcollect -ring /dev/shm/zlog-进程名.ring [-logpath ./log/进程名/进程名.log] [-compress]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kyle-hy/zlog"
+)
+
+func main() {
+	var (
+		ring     = flag.String("ring", "", "日志环路径, 如 /dev/shm/zlog-进程名.ring")
+		logPath  = flag.String("logpath", "", "日志文件路径, 默认 ./log/进程名/进程名.log")
+		compress = flag.Bool("compress", false, "当前日志文件流式gzip压缩")
+	)
+	flag.Parse()
+	if *ring == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []zlog.Option{zlog.Compress(*compress)}
+	if *logPath != "" {
+		opts = append(opts, zlog.LogPath(*logPath))
+	}
+	c := zlog.NewRingCollector(*ring, opts...)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		c.Close()
+	}()
+	if err := c.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "zlogcollect:", err)
+		os.Exit(1)
+	}
+	c.Close() // 等待日志文件写完
+}
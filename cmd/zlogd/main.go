@@ -0,0 +1,59 @@
+// zlogd 本机日志代理, 接收多个进程通过unix socket发送的日志, 按进程名写入 dir/进程名/进程名.log,
+// 沿用zlog的文件滚动, 同一路径只有zlogd一个写入者. 进程使用 zlogd:// 输出发送日志.
+//
+//	zlogd [-socket $XDG_RUNTIME_DIR/zlogd/zlogd.sock] [-dir ./log] [-rate 0] [-burst 0] [-compress]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kyle-hy/zlog"
+)
+
+func main() {
+	var (
+		socket   = flag.String("socket", zlog.DefaultAgentSocket(), "监听的unix socket, 所在目录的权限为0700")
+		dir      = flag.String("dir", "./log", "日志根目录")
+		rate     = flag.Float64("rate", 0, "每个进程每秒最多写入的日志条数, 0为不限制")
+		burst    = flag.Int("burst", 0, "限流允许的突发条数, 默认同rate")
+		compress = flag.Bool("compress", false, "当前日志文件流式gzip压缩")
+	)
+	flag.Parse()
+
+	if err := run(*socket, zlog.AgentConfig{
+		Dir:       *dir,
+		RateLimit: *rate,
+		Burst:     *burst,
+		Options:   []zlog.Option{zlog.Compress(*compress)},
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, "zlogd:", err)
+		os.Exit(1)
+	}
+}
+
+func run(socket string, cfg zlog.AgentConfig) error {
+	l, err := zlog.ListenAgent(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	agent := zlog.NewAgent(cfg)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	closed := make(chan struct{})
+	go func() {
+		<-sig
+		agent.Close()
+		close(closed)
+	}()
+	if err := agent.Serve(l); err != nil {
+		return err
+	}
+	<-closed // 等待日志文件写完
+	return nil
+}
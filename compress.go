@@ -0,0 +1,37 @@
+package zlog
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// gzipStreamWriter 当前日志文件的流式gzip压缩
+// 异步写协程每次Flush都做一次gzip同步刷新, 进程崩溃后文件中已刷新的部分仍可解压读取
+type gzipStreamWriter struct {
+	w  io.Writer
+	zw *gzip.Writer
+}
+
+func newGzipStreamWriter(w io.Writer) *gzipStreamWriter {
+	return &gzipStreamWriter{w: w, zw: gzip.NewWriter(w)}
+}
+
+// Write 压缩写入
+func (g *gzipStreamWriter) Write(p []byte) (n int, err error) {
+	return g.zw.Write(p)
+}
+
+// Flush 同步刷新压缩流, 产生一个可读取的刷新点
+func (g *gzipStreamWriter) Flush() error {
+	return g.zw.Flush()
+}
+
+// finish 结束当前gzip流
+func (g *gzipStreamWriter) finish() error {
+	return g.zw.Close()
+}
+
+// restart 在新文件上开始新的gzip流
+func (g *gzipStreamWriter) restart() {
+	g.zw.Reset(g.w)
+}
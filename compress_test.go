@@ -0,0 +1,69 @@
+package zlog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readLogFile(t *testing.T, path string) string {
+	t.Helper()
+	r, err := OpenLogFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return string(b)
+}
+
+// 进程崩溃时压缩流没有gzip结尾, 读到最后一个刷新点为止
+func TestGzipStreamCrashRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "room.log")
+	opt := defaultOptions
+	opt.logPath = path
+	opt.compress = true
+	wc, err := newFileWriter(&opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wc.Close()
+
+	var want strings.Builder
+	write := func(lines ...string) {
+		for _, l := range lines {
+			wc.Write([]byte(l))
+			want.WriteString(l)
+		}
+		if err := wc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("line1\n", "line2\n")
+	if got := readLogFile(t, path); got != want.String() {
+		t.Errorf("after first flush: %q", got)
+	}
+	write("line3\n")
+	wc.Write([]byte("unflushed\n"))
+	if got := readLogFile(t, path); got != want.String() {
+		t.Errorf("after second flush: %q", got)
+	}
+
+	// 最后一个刷新点写了一半
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cut := filepath.Join(filepath.Dir(path), "cut.log")
+	if err := os.WriteFile(cut, data[:len(data)-2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLogFile(t, cut); !strings.HasPrefix(want.String(), got) || !strings.HasPrefix(got, "line1\nline2\n") {
+		t.Errorf("cut in the last flush: %q", got)
+	}
+}
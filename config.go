@@ -0,0 +1,352 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// configEnvPrefix 覆盖配置文件的环境变量前缀, 变量名为前缀加大写的字段名, 如 ZLOG_LEVEL、ZLOG_BUFIO_SIZE
+const configEnvPrefix = "ZLOG_"
+
+// Config 配置文件的内容, 每个字段对应一个Option, 未设置的字段保持默认值
+type Config struct {
+	Level       string                 `json:"level" yaml:"level"`               // trace、debug、info、warn、error, 或 V(n) 的 vN
+	Path        string                 `json:"path" yaml:"path"`                 // 日志文件路径
+	WithGID     *bool                  `json:"with_gid" yaml:"with_gid"`         // 打印协程id
+	Stdout      *bool                  `json:"stdout" yaml:"stdout"`             // 同时打印到标准输出
+	Overflow    *bool                  `json:"overflow" yaml:"overflow"`         // 管道溢出时丢弃
+	Rotate      *bool                  `json:"rotate" yaml:"rotate"`             // lumberjack滚动
+	BufioSize   int                    `json:"bufio_size" yaml:"bufio_size"`     // 写文件的缓存大小
+	Fields      map[string]interface{} `json:"fields" yaml:"fields"`             // 默认附加的字段
+	Audit       *bool                  `json:"audit" yaml:"audit"`               // 开启审计日志
+	AuditPath   string                 `json:"audit_path" yaml:"audit_path"`     // 审计日志路径
+	HashChain   *bool                  `json:"hash_chain" yaml:"hash_chain"`     // 防篡改哈希链
+	EncryptKey  string                 `json:"encrypt_key" yaml:"encrypt_key"`   // hex编码的AES密钥
+	Compress    *bool                  `json:"compress" yaml:"compress"`         // 流式gzip压缩
+	Encoding    string                 `json:"encoding" yaml:"encoding"`         // json、zbin、gelf
+	OutputPaths []string               `json:"output_paths" yaml:"output_paths"` // 额外的输出
+	Outputs     []Output               `json:"outputs" yaml:"outputs"`           // 输出列表
+	Container   *bool                  `json:"container" yaml:"container"`       // 容器模式
+	K8sKeys     *bool                  `json:"k8s_keys" yaml:"k8s_keys"`         // k8s字段名
+	VModule     string                 `json:"vmodule" yaml:"vmodule"`           // 按源文件提高等级的规则
+	Sampling    SamplingConfig         `json:"sampling" yaml:"sampling"`         // 按消息采样
+	HashSample  HashSampleConfig       `json:"hash_sample" yaml:"hash_sample"`   // 按字段值一致性哈希采样
+}
+
+// SamplingConfig 按消息采样的配置, 见 Sampling
+type SamplingConfig struct {
+	Tick       string `json:"tick" yaml:"tick"` // 间隔, 如 1s, 默认1秒
+	First      int    `json:"first" yaml:"first"`
+	Thereafter int    `json:"thereafter" yaml:"thereafter"`
+}
+
+// HashSampleConfig 按字段值一致性哈希采样的配置, 见 HashSampling
+type HashSampleConfig struct {
+	Key    string  `json:"key" yaml:"key"`
+	Rate   float64 `json:"rate" yaml:"rate"`     // 输出的比例, (0, 1], 1为不采样
+	Errors bool    `json:"errors" yaml:"errors"` // error以上的日志也采样, 见 HashSampleErrors
+}
+
+// InitFromFile 读取JSON或YAML配置文件初始化日志, 按扩展名区分格式, 环境变量 ZLOG_* 覆盖文件中的值
+func InitFromFile(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	return initFromConfig(cfg)
+}
+
+// InitFromBytes 解析JSON或YAML配置初始化日志, 以 { 开头为JSON, 否则为YAML, 环境变量 ZLOG_* 覆盖配置中的值
+func InitFromBytes(data []byte) error {
+	cfg, err := parseConfig(data, "")
+	if err != nil {
+		return err
+	}
+	return initFromConfig(cfg)
+}
+
+// initFromConfig 记录配置和应用配置前的选项, 供重新加载时对比
+func initFromConfig(cfg *Config) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	base := defaultOptions
+	if err := InitLog(cfg.option()); err != nil {
+		return err
+	}
+	appConfig, configBase = cfg, base
+	return nil
+}
+
+// loadConfig 读取配置文件
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("zlog: config: %w", err)
+	}
+	format := ""
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		format = "json"
+	case ".yaml", ".yml":
+		format = "yaml"
+	}
+	cfg, err := parseConfig(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, path)
+	}
+	return cfg, nil
+}
+
+// parseConfig 严格解析配置, 未知字段报错, 之后应用环境变量并校验
+func parseConfig(data []byte, format string) (*Config, error) {
+	if format == "" {
+		format = "yaml"
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			format = "json"
+		}
+	}
+
+	cfg := &Config{}
+	var err error
+	if format == "json" {
+		err = decodeJSONConfig(data, cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); errors.Is(err, io.EOF) {
+			err = nil // 空文档
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zlog: config: %w", err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decodeJSONConfig 语法错误转换为行号
+func decodeJSONConfig(data []byte, cfg *Config) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(cfg)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("line %d: %w", jsonLine(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("line %d: field %s: %w", jsonLine(data, typeErr.Offset), typeErr.Field, err)
+	}
+	return err
+}
+
+func jsonLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// applyEnv 环境变量覆盖配置, 变量名为 ZLOG_ 加大写的yaml字段名, 列表以逗号分隔, fields、outputs 和采样配置不支持
+func (c *Config) applyEnv() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		name := configEnvPrefix + strings.ToUpper(tag)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(s)
+		case reflect.Int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("zlog: config: env %s=%q is not an integer", name, s)
+			}
+			f.SetInt(int64(n))
+		case reflect.Ptr:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("zlog: config: env %s=%q is not a bool", name, s)
+			}
+			f.Set(reflect.ValueOf(&b))
+		case reflect.Slice:
+			if f.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			var paths []string
+			for _, p := range strings.Split(s, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					paths = append(paths, p)
+				}
+			}
+			f.Set(reflect.ValueOf(paths))
+		}
+	}
+	return nil
+}
+
+// validate 校验取值, 错误中给出可选值
+func (c *Config) validate() error {
+	if c.Level != "" {
+		if _, err := parseLevel(c.Level); err != nil {
+			return fmt.Errorf("zlog: config: %w", err)
+		}
+	}
+	if c.BufioSize < 0 {
+		return fmt.Errorf("zlog: config: bufio_size %d must not be negative", c.BufioSize)
+	}
+	if c.EncryptKey != "" {
+		key, err := hex.DecodeString(c.EncryptKey)
+		if err != nil {
+			return fmt.Errorf("zlog: config: encrypt_key must be hex: %w", err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return fmt.Errorf("zlog: config: encrypt_key is %d bytes, want 16, 24 or 32", n)
+		}
+	}
+	if c.Encoding != "" {
+		switch c.Encoding {
+		case "json", BinaryEncoding, GELFEncoding:
+		default:
+			return fmt.Errorf("zlog: config: encoding %q invalid, want json, %s or %s", c.Encoding, BinaryEncoding, GELFEncoding)
+		}
+		if c.Encoding == BinaryEncoding && c.HashChain != nil && *c.HashChain {
+			return fmt.Errorf("zlog: config: hash_chain requires json encoding, not %s", BinaryEncoding)
+		}
+	}
+	if c.VModule != "" {
+		if _, err := parseVModule(c.VModule); err != nil {
+			return fmt.Errorf("zlog: config: %w", err)
+		}
+	}
+	if s := c.Sampling; s != (SamplingConfig{}) {
+		if s.Tick != "" {
+			if d, err := time.ParseDuration(s.Tick); err != nil || d <= 0 {
+				return fmt.Errorf("zlog: config: sampling.tick %q invalid, want a positive duration like 1s", s.Tick)
+			}
+		}
+		if s.First <= 0 || s.Thereafter < 0 {
+			return fmt.Errorf("zlog: config: sampling.first must be positive and sampling.thereafter must not be negative")
+		}
+	}
+	if s := c.HashSample; s != (HashSampleConfig{}) {
+		if s.Key == "" {
+			return fmt.Errorf("zlog: config: hash_sample.key is required")
+		}
+		if s.Rate <= 0 || s.Rate > 1 {
+			return fmt.Errorf("zlog: config: hash_sample.rate %v invalid, want (0, 1]", s.Rate)
+		}
+	}
+	for i, out := range c.Outputs {
+		if out.URL == "" {
+			return fmt.Errorf("zlog: config: outputs[%d]: url is required", i)
+		}
+		if out.Level != "" {
+			if _, err := parseLevel(out.Level); err != nil {
+				return fmt.Errorf("zlog: config: outputs[%d]: %w", i, err)
+			}
+		}
+		if out.Encoding != "" {
+			if _, err := newOutputEncoder(out.Encoding, false); err != nil {
+				return fmt.Errorf("zlog: config: outputs[%d]: encoding %q invalid, want json, console, color, gelf or zbin", i, out.Encoding)
+			}
+			if _, err := outputEncoding(out, "json"); err != nil {
+				return fmt.Errorf("zlog: config: outputs[%d]: encoding %q is not supported by %s", i, out.Encoding, out.URL)
+			}
+		}
+	}
+	return nil
+}
+
+// option 把配置转换为Option, 只设置配置中出现的字段
+func (c *Config) option() Option {
+	return func(o *Options) {
+		if c.Level != "" {
+			o.level, _ = parseLevel(c.Level)
+		}
+		if c.Path != "" {
+			o.logPath = c.Path
+		}
+		setBool(&o.withGID, c.WithGID)
+		setBool(&o.stdout, c.Stdout)
+		setBool(&o.overflow, c.Overflow)
+		setBool(&o.rotate, c.Rotate)
+		if c.BufioSize > 0 {
+			o.bufioSize = c.BufioSize
+		}
+		if c.Fields != nil {
+			o.fields = c.Fields
+		}
+		setBool(&o.audit, c.Audit)
+		if c.AuditPath != "" {
+			o.audit = true
+			o.auditPath = c.AuditPath
+		}
+		setBool(&o.hashChain, c.HashChain)
+		if c.EncryptKey != "" {
+			o.encryptKey, _ = hex.DecodeString(c.EncryptKey)
+		}
+		setBool(&o.compress, c.Compress)
+		if c.Encoding != "" {
+			o.encoding = c.Encoding
+		}
+		if c.OutputPaths != nil {
+			o.outputPaths = c.OutputPaths
+		}
+		if c.Outputs != nil {
+			o.outputs = c.Outputs
+		}
+		setBool(&o.container, c.Container)
+		setBool(&o.k8sKeys, c.K8sKeys)
+		if c.VModule != "" {
+			o.vmodule = c.VModule
+		}
+		if c.Sampling != (SamplingConfig{}) {
+			o.sampleTick, _ = time.ParseDuration(c.Sampling.Tick)
+			o.sampleFirst, o.sampleThereafter = c.Sampling.First, c.Sampling.Thereafter
+		}
+		if c.HashSample != (HashSampleConfig{}) {
+			o.hashSampleKey, o.hashSampleRate = c.HashSample.Key, c.HashSample.Rate
+			o.hashSampleErrors = c.HashSample.Errors
+		}
+	}
+}
+
+func setBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// parseLevel 解析日志等级, 不区分大小写
+func parseLevel(s string) (zapcore.Level, error) {
+	l, ok := textLevel(strings.TrimSpace(s))
+	if !ok {
+		return l, fmt.Errorf("level %q invalid, want trace, debug, info, warn, error, dpanic, panic, fatal or v0-v%d", s, maxVerbosity)
+	}
+	return l, nil
+}
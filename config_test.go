@@ -0,0 +1,69 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseConfigErrors(t *testing.T) {
+	cases := []struct {
+		name, format, data, want string
+	}{
+		{"unknown yaml field", "yaml", "level: info\nlevle: debug\n", "field levle not found"},
+		{"unknown json field", "json", "{\"level\": \"info\",\n\"levle\": \"debug\"}", `unknown field "levle"`},
+		{"json syntax", "json", "{\"level\": \"info\",\n\"path\": }", "line 2"},
+		{"json type", "json", "{\n\"bufio_size\": \"4k\"}", "line 2: field bufio_size"},
+		{"level", "yaml", "level: verbose\n", "verbose"},
+		{"bufio size", "yaml", "bufio_size: -1\n", "bufio_size -1 must not be negative"},
+		{"encrypt key", "yaml", "encrypt_key: 0011\n", "encrypt_key is 2 bytes"},
+		{"encoding", "yaml", "encoding: xml\n", `encoding "xml" invalid`},
+		{"hash chain binary", "yaml", "encoding: zbin\nhash_chain: true\n", "hash_chain requires json encoding"},
+		{"sampling", "yaml", "sampling:\n  thereafter: 10\n", "sampling.first must be positive"},
+		{"hash sample key", "yaml", "hash_sample:\n  rate: 0.1\n", "hash_sample.key is required"},
+		{"output url", "yaml", "outputs:\n  - level: info\n", "outputs[0]: url is required"},
+	}
+	for _, c := range cases {
+		_, err := parseConfig([]byte(c.data), c.format)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestConfigEnvOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zlog.yaml")
+	if err := os.WriteFile(path, []byte("level: debug\nbufio_size: 4096\nstdout: false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ZLOG_LEVEL", "warn")
+	t.Setenv("ZLOG_STDOUT", "true")
+	t.Setenv("ZLOG_OUTPUT_PATHS", "stderr, stdout")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := defaultOptions
+	cfg.option()(&opt)
+	if opt.level != zapcore.WarnLevel || opt.bufioSize != 4096 || !opt.stdout {
+		t.Errorf("level %v, bufio_size %d, stdout %v", opt.level, opt.bufioSize, opt.stdout)
+	}
+	if len(opt.outputPaths) != 2 || opt.outputPaths[0] != "stderr" || opt.outputPaths[1] != "stdout" {
+		t.Errorf("output_paths %q", opt.outputPaths)
+	}
+
+	// 环境变量的值同样校验
+	t.Setenv("ZLOG_LEVEL", "verbose")
+	if _, err := loadConfig(path); err == nil {
+		t.Error("invalid ZLOG_LEVEL accepted")
+	}
+	t.Setenv("ZLOG_LEVEL", "warn")
+	t.Setenv("ZLOG_BUFIO_SIZE", "4k")
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "ZLOG_BUFIO_SIZE") {
+		t.Errorf("ZLOG_BUFIO_SIZE=4k: err = %v", err)
+	}
+}
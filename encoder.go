@@ -3,6 +3,7 @@ package zlog
 import (
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"go.uber.org/zap/zapcore"
@@ -20,5 +21,23 @@ func ext(path string) string {
 
 // callerEncoder will add caller to log. format is "filename:lineNum:funcName", e.g:"zaplog/zaplog_test.go:15:zaplog.TestNewLogger"
 func callerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
-	enc.AppendString(strings.Join([]string{caller.TrimmedPath(), ext(runtime.FuncForPC(caller.PC).Name())}, ":"))
+	enc.AppendString(callerString(caller))
+}
+
+// callerString 格式为 "filename:lineNum:funcName"
+func callerString(caller zapcore.EntryCaller) string {
+	return strings.Join([]string{caller.TrimmedPath(), ext(runtime.FuncForPC(caller.PC).Name())}, ":")
+}
+
+// splitCaller 拆分 callerString 的输出 "filename:lineNum:funcName"
+func splitCaller(s string) (file string, line int, fn string) {
+	parts := strings.SplitN(s, ":", 3)
+	file = parts[0]
+	if len(parts) > 1 {
+		line, _ = strconv.Atoi(parts[1])
+	}
+	if len(parts) > 2 {
+		fn = parts[2]
+	}
+	return file, line, fn
 }
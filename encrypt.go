@@ -0,0 +1,220 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	encryptChunkSize  = 64 * 1024 // 明文块达到该大小即加密写出
+	encryptPrefixSize = 8         // magic(4) + 密文长度(4)
+	encryptFileIDSize = 16
+	encryptHeaderSize = encryptPrefixSize + encryptFileIDSize + 8 + 1 // + 文件ID + 块序号(8) + 标志(1)
+	encryptFlagFinal  = 1                                             // 文件的最后一块
+)
+
+// 加密块的magic, 块格式: magic | 长度(nonce+密文, 大端uint32) | 文件ID | 块序号(大端uint64) | 标志 | nonce | 密文(含GCM tag).
+// 整个块头作为GCM的附加数据, 每个文件随机生成文件ID, 块序号从0递增, 关闭和滚动时写出带结束标志的最后一块,
+// 块被删除、重排、重复、跨文件替换或在块边界截断都能发现
+var encryptMagic = []byte("ZLE2")
+
+var errEncryptKeyMissing = errors.New("zlog: encrypted log file, key required")
+
+// ErrLogUnfinished 日志文件未写完: 正在写入、进程崩溃或被截断, 如加密文件没有结束块、二进制文件最后一条记录不完整
+var ErrLogUnfinished = errors.New("zlog: log file is unfinished (still being written, crashed or truncated)")
+
+// newAEAD 由AES密钥(16/24/32字节)创建AES-GCM
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("zlog: invalid encrypt key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptWriter 日志落盘加密
+// 明文先缓存, 写满一块或异步写协程Flush时整块AES-GCM加密后一次写入文件,
+// 每块自带nonce和长度且一次Write写出, lumberjack滚动不会把块切到两个文件, 每个文件可独立解密
+type encryptWriter struct {
+	w        io.Writer
+	aead     cipher.AEAD
+	pending  []byte
+	out      []byte
+	fileID   [encryptFileIDSize]byte
+	index    uint64 // 下一块的序号
+	finished bool   // 已写出结束块
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	e := &encryptWriter{w: w, aead: aead, pending: make([]byte, 0, encryptChunkSize)}
+	if _, err := rand.Read(e.fileID[:]); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Write 缓存明文, 满一块则加密写出
+func (e *encryptWriter) Write(p []byte) (n int, err error) {
+	e.pending = append(e.pending, p...)
+	if len(e.pending) >= encryptChunkSize {
+		if err := e.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 加密并写出缓存的明文
+func (e *encryptWriter) Flush() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	return e.seal(0)
+}
+
+// seal 加密缓存的明文写出一块
+func (e *encryptWriter) seal(flags byte) error {
+	nonceSize := e.aead.NonceSize()
+	size := nonceSize + len(e.pending) + e.aead.Overhead()
+	e.out = append(e.out[:0], make([]byte, encryptHeaderSize)...)
+	header := e.out[:encryptHeaderSize]
+	copy(header, encryptMagic)
+	binary.BigEndian.PutUint32(header[len(encryptMagic):], uint32(size))
+	copy(header[encryptPrefixSize:], e.fileID[:])
+	binary.BigEndian.PutUint64(header[encryptPrefixSize+encryptFileIDSize:], e.index)
+	header[encryptHeaderSize-1] = flags
+
+	e.out = append(e.out, make([]byte, nonceSize)...)
+	nonce := e.out[encryptHeaderSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	e.out = e.aead.Seal(e.out, nonce, e.pending, header)
+
+	e.pending = e.pending[:0]
+	e.index++
+	_, err := e.w.Write(e.out)
+	return err
+}
+
+// finish 滚动和关闭前写出剩余明文作为结束块
+func (e *encryptWriter) finish() error {
+	if e.finished {
+		return nil
+	}
+	e.finished = true
+	return e.seal(encryptFlagFinal)
+}
+
+// restart 新文件使用新的文件ID, 块序号从0开始
+func (e *encryptWriter) restart() {
+	rand.Read(e.fileID[:])
+	e.index = 0
+	e.finished = false
+}
+
+// decryptReader 逐块解密日志文件, 校验块序号和文件ID
+type decryptReader struct {
+	r        *bufio.Reader
+	aead     cipher.AEAD
+	buf      []byte // 已解密未读取的明文
+	in       []byte
+	chunks   uint64
+	fileID   [encryptFileIDSize]byte
+	finished bool
+}
+
+func newDecryptReader(r *bufio.Reader, key []byte) (*decryptReader, error) {
+	if len(key) == 0 {
+		return nil, errEncryptKeyMissing
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+// Read 读取解密后的明文, 文件尾部的不完整块(如进程崩溃)返回io.ErrUnexpectedEOF, 没有结束块返回 ErrLogUnfinished
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	header := make([]byte, encryptHeaderSize)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		if err == io.EOF && !d.finished {
+			return ErrLogUnfinished
+		}
+		return err
+	}
+	if d.finished {
+		return errors.New("zlog: encrypted chunk after the final chunk")
+	}
+	if !bytes.Equal(header[:len(encryptMagic)], encryptMagic) {
+		return fmt.Errorf("zlog: bad encrypted chunk magic %q", header[:len(encryptMagic)])
+	}
+	if err := d.checkSequence(header); err != nil {
+		return err
+	}
+	size := int(binary.BigEndian.Uint32(header[len(encryptMagic):]))
+	if size < d.aead.NonceSize()+d.aead.Overhead() {
+		return errors.New("zlog: bad encrypted chunk size")
+	}
+
+	if cap(d.in) < size {
+		d.in = make([]byte, size)
+	}
+	d.in = d.in[:size]
+	if _, err := io.ReadFull(d.r, d.in); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	nonce, ciphertext := d.in[:d.aead.NonceSize()], d.in[d.aead.NonceSize():]
+	plain, err := d.aead.Open(ciphertext[:0], nonce, ciphertext, header)
+	if err != nil {
+		return fmt.Errorf("zlog: decrypt chunk %d: %w", d.chunks, err)
+	}
+	d.buf = plain
+	d.chunks++
+	if header[encryptHeaderSize-1]&encryptFlagFinal != 0 {
+		d.finished = true
+	}
+	return nil
+}
+
+// checkSequence 块序号从0连续递增, 同一文件的文件ID相同. 块头已由GCM认证, 解密失败的块不会通过
+func (d *decryptReader) checkSequence(header []byte) error {
+	id := header[encryptPrefixSize : encryptPrefixSize+encryptFileIDSize]
+	index := binary.BigEndian.Uint64(header[encryptPrefixSize+encryptFileIDSize:])
+	if d.chunks == 0 {
+		copy(d.fileID[:], id)
+	} else if !bytes.Equal(d.fileID[:], id) {
+		return fmt.Errorf("zlog: encrypted chunk %d belongs to another file", d.chunks)
+	}
+	if index != d.chunks {
+		return fmt.Errorf("zlog: encrypted chunk %d has index %d, chunks are missing, reordered or duplicated", d.chunks, index)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testEncryptKey = []byte("0123456789abcdef")
+
+// encryptChunks 每行加密为一块, 最后一行为结束块, 返回各块的密文
+func encryptChunks(t *testing.T, lines ...string) [][]byte {
+	t.Helper()
+	var buf bytes.Buffer
+	ew, err := newEncryptWriter(&buf, testEncryptKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks [][]byte
+	for i, line := range lines {
+		ew.Write([]byte(line))
+		if i == len(lines)-1 {
+			err = ew.finish()
+		} else {
+			err = ew.Flush()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, append([]byte(nil), buf.Bytes()...))
+		buf.Reset()
+	}
+	return chunks
+}
+
+func decryptAll(data []byte) (string, error) {
+	dr, err := newDecryptReader(bufio.NewReader(bytes.NewReader(data)), testEncryptKey)
+	if err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(dr)
+	return string(b), err
+}
+
+func TestDecryptChunks(t *testing.T) {
+	c := encryptChunks(t, "line1\n", "line2\n", "line3\n")
+	other := encryptChunks(t, "line1\n", "line2\n", "line3\n")
+	join := func(chunks ...[]byte) []byte { return bytes.Join(chunks, nil) }
+
+	if got, err := decryptAll(join(c...)); err != nil || got != "line1\nline2\nline3\n" {
+		t.Fatalf("intact: %q %v", got, err)
+	}
+
+	tampered := join(c...)
+	tampered[len(c[0])+len(c[1])-1] ^= 1 // 第二块的GCM tag
+	index := join(c...)
+	index[len(c[0])+encryptHeaderSize-2]++ // 第二块的块序号
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"tampered", tampered},
+		{"tampered index", index},
+		{"reordered", join(c[0], c[2], c[1])},
+		{"removed", join(c[0], c[2])},
+		{"duplicated", join(c[0], c[1], c[1], c[2])},
+		{"other file", join(c[0], other[1], c[2])},
+		{"after final", join(c[0], c[1], c[2], other[0])},
+	}
+	for _, tc := range cases {
+		if _, err := decryptAll(tc.data); err == nil || errors.Is(err, ErrLogUnfinished) {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+
+	// 在块边界截断时之前的块正常解密, 报告未写完; 在块中间截断时报告不完整的块
+	got, err := decryptAll(join(c[0], c[1]))
+	if !errors.Is(err, ErrLogUnfinished) || got != "line1\nline2\n" {
+		t.Errorf("truncated at chunk boundary: %q %v", got, err)
+	}
+	got, err = decryptAll(join(c[0], c[1], c[2][:len(c[2])-3]))
+	if err != io.ErrUnexpectedEOF || got != "line1\nline2\n" {
+		t.Errorf("truncated chunk: %q %v", got, err)
+	}
+}
+
+func TestOpenLogFileEncryptFormat(t *testing.T) {
+	dir := t.TempDir()
+	c := encryptChunks(t, "line1\n")
+	path := filepath.Join(dir, "enc.log")
+	if err := os.WriteFile(path, c[0], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLogFile(path, nil); err != errEncryptKeyMissing {
+		t.Errorf("no key: err = %v", err)
+	}
+
+	// 旧版本和未知版本的块格式不再支持
+	old := append([]byte("ZLE1"), c[0][len(encryptMagic):]...)
+	if err := os.WriteFile(path, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := OpenLogFile(path, testEncryptKey); err == nil {
+		r.Close()
+		t.Error("ZLE1 file opened")
+	}
+}
@@ -0,0 +1,242 @@
+package zlog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultFieldLevelDuration 按字段值设置的等级未指定时长时的有效期
+const defaultFieldLevelDuration = 30 * time.Minute
+
+// FieldLevel 按字段值设置的等级, 带有该字段的日志不受全局和logger等级限制
+type FieldLevel struct {
+	Key     string
+	Value   string
+	Level   zapcore.Level
+	Expires time.Time
+}
+
+type fieldLevelKey struct {
+	key, value string
+}
+
+// fieldLevelState 一组字段值等级, 修改时整体替换, 读取无锁
+type fieldLevelState struct {
+	levels map[fieldLevelKey]FieldLevel
+	keys   map[string]struct{}
+	min    zapcore.Level
+}
+
+var fieldLevels struct {
+	mu     sync.Mutex
+	timers map[fieldLevelKey]*time.Timer
+	state  atomic.Value // *fieldLevelState
+}
+
+// SetFieldLevel 对带有字段key且值为value的日志输出l以上的等级, d后自动删除, d<=0时为30分钟.
+// 值按字符串比较, 整数字段为十进制, 如 SetFieldLevel("uid", "10086", zapcore.DebugLevel, time.Hour)
+func SetFieldLevel(key, value string, l zapcore.Level, d time.Duration) {
+	if d <= 0 {
+		d = defaultFieldLevelDuration
+	}
+	k := fieldLevelKey{key, value}
+	fieldLevels.mu.Lock()
+	defer fieldLevels.mu.Unlock()
+	if t := fieldLevels.timers[k]; t != nil {
+		t.Stop()
+	}
+	if fieldLevels.timers == nil {
+		fieldLevels.timers = make(map[fieldLevelKey]*time.Timer)
+	}
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		fieldLevels.mu.Lock()
+		defer fieldLevels.mu.Unlock()
+		if fieldLevels.timers[k] == t {
+			removeFieldLevel(k)
+		}
+	})
+	fieldLevels.timers[k] = t
+	updateFieldLevels(func(m map[fieldLevelKey]FieldLevel) {
+		m[k] = FieldLevel{Key: key, Value: value, Level: l, Expires: time.Now().Add(d)}
+	})
+}
+
+// UnsetFieldLevel 删除按字段值设置的等级
+func UnsetFieldLevel(key, value string) {
+	fieldLevels.mu.Lock()
+	defer fieldLevels.mu.Unlock()
+	removeFieldLevel(fieldLevelKey{key, value})
+}
+
+// DebugUID d时间内输出该uid的debug日志
+func DebugUID(uid uint64, d time.Duration) {
+	SetFieldLevel(logCommonKeyUID, strconv.FormatUint(uid, 10), zapcore.DebugLevel, d)
+}
+
+// DebugRoom d时间内输出该房间的debug日志
+func DebugRoom(roomID uint64, d time.Duration) {
+	SetFieldLevel(logCommonKeyRoomID, strconv.FormatUint(roomID, 10), zapcore.DebugLevel, d)
+}
+
+// FieldLevels 按字段值设置的等级, 按字段名和值排序
+func FieldLevels() []FieldLevel {
+	s := loadFieldLevels()
+	if s == nil {
+		return nil
+	}
+	list := make([]FieldLevel, 0, len(s.levels))
+	for _, fl := range s.levels {
+		list = append(list, fl)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Key != list[j].Key {
+			return list[i].Key < list[j].Key
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
+
+func loadFieldLevels() *fieldLevelState {
+	s, _ := fieldLevels.state.Load().(*fieldLevelState)
+	return s
+}
+
+// removeFieldLevel 调用方持有 fieldLevels.mu
+func removeFieldLevel(k fieldLevelKey) {
+	if t := fieldLevels.timers[k]; t != nil {
+		t.Stop()
+		delete(fieldLevels.timers, k)
+	}
+	updateFieldLevels(func(m map[fieldLevelKey]FieldLevel) { delete(m, k) })
+}
+
+// updateFieldLevels 写时复制, 调用方持有 fieldLevels.mu
+func updateFieldLevels(fn func(map[fieldLevelKey]FieldLevel)) {
+	s := &fieldLevelState{levels: make(map[fieldLevelKey]FieldLevel), keys: make(map[string]struct{}), min: vmoduleNone}
+	if old := loadFieldLevels(); old != nil {
+		for k, v := range old.levels {
+			s.levels[k] = v
+		}
+	}
+	fn(s.levels)
+	if len(s.levels) == 0 {
+		fieldLevels.state.Store((*fieldLevelState)(nil))
+		return
+	}
+	for k, v := range s.levels {
+		s.keys[k.key] = struct{}{}
+		if v.Level < s.min {
+			s.min = v.Level
+		}
+	}
+	fieldLevels.state.Store(s)
+}
+
+// enabled 是否有字段值可能输出该等级
+func (s *fieldLevelState) enabled(l zapcore.Level) bool {
+	return s != nil && l >= s.min
+}
+
+// has 是否对该字段值设置了未过期的等级
+func (s *fieldLevelState) has(key, value string) bool {
+	if s == nil {
+		return false
+	}
+	fl, ok := s.levels[fieldLevelKey{key, value}]
+	return ok && time.Now().Before(fl.Expires)
+}
+
+// match 字段中是否有值设置了允许该等级的未过期等级
+func (s *fieldLevelState) match(fields []zapcore.Field, l zapcore.Level) bool {
+	if !s.enabled(l) {
+		return false
+	}
+	for _, f := range fields {
+		if _, ok := s.keys[f.Key]; !ok {
+			continue
+		}
+		v, ok := fieldValueString(f)
+		if !ok {
+			continue
+		}
+		if fl, ok := s.levels[fieldLevelKey{f.Key, v}]; ok && fl.Level.Enabled(l) && time.Now().Before(fl.Expires) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldValueString 整数和字符串字段的值, 其他类型不参与匹配
+func fieldValueString(f zapcore.Field) (string, bool) {
+	switch f.Type {
+	case zapcore.StringType:
+		return f.String, true
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		return strconv.FormatInt(f.Integer, 10), true
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type, zapcore.UintptrType:
+		return strconv.FormatUint(uint64(f.Integer), 10), true
+	case zapcore.StringerType:
+		if s, ok := f.Interface.(fmt.Stringer); ok {
+			return s.String(), true
+		}
+	}
+	return "", false
+}
+
+// fieldMatchable 可参与字段值匹配的字段, With 时保留
+func fieldMatchable(f zapcore.Field) bool {
+	switch f.Type {
+	case zapcore.StringType, zapcore.StringerType,
+		zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type,
+		zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type, zapcore.UintptrType:
+		return true
+	}
+	return false
+}
+
+// fieldLevelCore 等级未开启但可能有字段值匹配的日志, 在写入时按日志的字段判断, 匹配时交给内层的输出
+type fieldLevelCore struct {
+	c *namedLevelCore
+}
+
+func (f fieldLevelCore) Enabled(zapcore.Level) bool { return true }
+
+func (f fieldLevelCore) With(fields []zapcore.Field) zapcore.Core { return f.c.With(fields) }
+
+func (f fieldLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, f)
+}
+
+func (f fieldLevelCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !loadFieldLevels().match(fields, ent.Level) {
+		return nil
+	}
+	// 经过内层的判断, 保持各输出自己的等级
+	return writeEnabled(f.c.Core, ent, fields)
+}
+
+func (f fieldLevelCore) Sync() error { return nil }
+
+// enabledWriter 不经过 CheckedEntry 直接写入的core, 按 Check 的判断写入并返回各输出的写入错误
+type enabledWriter interface {
+	writeEnabled(ent zapcore.Entry, fields []zapcore.Field) error
+}
+
+// writeEnabled 按core的 Check 判断写入, 返回写入错误. CheckedEntry.Write 只把错误写到 ErrorOutput, 内层写入时不经过它
+func writeEnabled(core zapcore.Core, ent zapcore.Entry, fields []zapcore.Field) error {
+	if w, ok := core.(enabledWriter); ok {
+		return w.writeEnabled(ent, fields)
+	}
+	if !core.Enabled(ent.Level) {
+		return nil
+	}
+	return core.Write(ent, fields)
+}
@@ -10,6 +10,11 @@ const (
 	logCommonKeyRoomID = "roomID"
 	logCommonKeyHostID = "hostID"
 	logCommonKeyGoID   = "goID"
+
+	logCommonKeySuppressed = "suppressed"
+
+	logCommonKeyTraceID = "traceID"
+	logCommonKeySpanID  = "spanID"
 )
 
 // UID 通用的uid field
@@ -36,3 +41,18 @@ func HostID(hostID uint64) zapcore.Field {
 func GoID(goID int64) zapcore.Field {
 	return zap.Int64(logCommonKeyGoID, goID)
 }
+
+// TraceID 链路追踪的trace id, 32位十六进制
+func TraceID(traceID string) zapcore.Field {
+	return zap.String(logCommonKeyTraceID, traceID)
+}
+
+// SpanID 链路追踪的span id, 16位十六进制
+func SpanID(spanID string) zapcore.Field {
+	return zap.String(logCommonKeySpanID, spanID)
+}
+
+// Suppressed 限频时上次输出后被抑制的次数, 见 Every
+func Suppressed(n uint64) zapcore.Field {
+	return zap.Uint64(logCommonKeySuppressed, n)
+}
@@ -0,0 +1,211 @@
+package zlog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	megabyte         = 1024 * 1024
+	backupTimeFormat = "2006-01-02T15-04-05.000" // 同lumberjack备份文件名中的时间
+)
+
+// errHashChainBinary 哈希链按json行计算, 不支持二进制编码
+var errHashChainBinary = errors.New("zlog: hash chain requires json encoding, not " + BinaryEncoding)
+
+// flushers 按顺序依次Flush写入链上的各级缓存
+type flushers []Flusher
+
+// Flush 依次Flush, 返回第一个错误
+func (fs flushers) Flush() error {
+	for _, f := range fs {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamStage 写入链上带状态的流式层(压缩流、加密块),
+// 滚动和关闭前需要收尾, 滚动后在新文件上重新开始
+type streamStage interface {
+	Flusher
+	finish() error
+	restart()
+}
+
+// fileSink 写入链底层的日志文件
+// 有流式层时由fileSink在Flush点主动滚动, 此时上层缓存已全部写出, 压缩流和加密块不会被切到两个文件
+type fileSink struct {
+	file   io.WriteCloser
+	lj     *lumberjack.Logger // 非nil时主动滚动
+	size   int64              // 当前文件大小
+	limit  int64              // 滚动阈值
+	stages []streamStage      // 流式层, 自上而下
+}
+
+// Write 写文件并累计文件大小
+func (f *fileSink) Write(p []byte) (n int, err error) {
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Flush 文件超过阈值则滚动
+func (f *fileSink) Flush() error {
+	if f.lj == nil || f.size < f.limit {
+		return nil
+	}
+	return f.rotate()
+}
+
+func (f *fileSink) rotate() error {
+	for _, s := range f.stages {
+		if err := s.finish(); err != nil {
+			return err
+		}
+	}
+	if err := f.lj.Rotate(); err != nil {
+		return err
+	}
+	f.size = 0
+	for _, s := range f.stages {
+		s.restart()
+	}
+	return nil
+}
+
+// Close 各流式层收尾后关闭文件
+func (f *fileSink) Close() error {
+	for _, s := range f.stages {
+		s.finish()
+	}
+	return f.file.Close()
+}
+
+// newFileSink 打开日志文件
+func newFileSink(opt *Options, filePath string) (*fileSink, error) {
+	// 哈希链的一行可能被bufio分成多次写入, 同样只在Flush点滚动, 避免一行被切到两个文件
+	streaming := opt.compress || len(opt.encryptKey) > 0 || opt.encoding == BinaryEncoding || opt.hashChain
+	// 上次进程可能异常退出留下未结束的压缩流、加密块序列或不完整的二进制记录, 新的流不能接在其后
+	freshFile := opt.compress || len(opt.encryptKey) > 0 || opt.encoding == BinaryEncoding
+	if !opt.rotate {
+		err := os.MkdirAll(filepath.Dir(filePath), 0755)
+		if err != nil {
+			return nil, err
+		}
+		if freshFile {
+			if err := moveAside(filePath); err != nil {
+				return nil, err
+			}
+		}
+		openFlag := os.O_CREATE | os.O_WRONLY | os.O_APPEND // 使用第三方程序rotate的话，用append模式打开，否则会形成空洞的大文件
+		file, err := os.OpenFile(filePath, openFlag, os.FileMode(0644))
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{file: file}, nil
+	}
+
+	lj := &lumberjack.Logger{
+		Filename:   filePath,
+		Compress:   !opt.compress, // 已经是压缩流则滚动后不再压缩
+		LocalTime:  true,
+		MaxSize:    maxFileSize,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAge,
+	}
+	if !streaming {
+		return &fileSink{file: lj}, nil
+	}
+
+	// 由fileSink主动滚动, lumberjack自身不再按大小滚动
+	lj.MaxSize = math.MaxInt32
+	f := &fileSink{file: lj, lj: lj, limit: maxFileSize * megabyte}
+	if info, err := os.Stat(filePath); err == nil {
+		f.size = info.Size()
+	}
+	if freshFile && f.size > 0 {
+		if err := f.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// moveAside 非空的日志文件按lumberjack备份文件的命名改名, 由第三方程序rotate时新的流从空文件开始
+func moveAside(filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	ext := filepath.Ext(filePath)
+	prefix := strings.TrimSuffix(filePath, ext)
+	return os.Rename(filePath, prefix+"-"+time.Now().Format(backupTimeFormat)+ext)
+}
+
+// newFileWriter 创建异步日志落盘的写入链: [哈希链|二进制字典] -> bufio -> [压缩] -> [加密] -> 文件
+func newFileWriter(opt *Options) (*WriteCloseFlusher, error) {
+	if opt.hashChain && opt.encoding == BinaryEncoding {
+		return nil, errHashChainBinary
+	}
+	filePath := getLogFilePath(opt)
+	// 先读出哈希链的最后一个节点再打开文件: 打开时可能滚动, 滚动后的备份由lumberjack在后台压缩, 压缩完成前读到的是不完整的gz
+	var chainSeq uint64
+	var chainPrev string
+	if opt.hashChain {
+		var err error
+		if chainSeq, chainPrev, err = lastChainLink(filePath, opt.encryptKey); err != nil {
+			return nil, err
+		}
+	}
+	file, err := newFileSink(opt, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out io.Writer = file
+		fs            = flushers{file}
+	)
+	if len(opt.encryptKey) > 0 {
+		ew, err := newEncryptWriter(out, opt.encryptKey)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		out = ew
+		fs = append(flushers{ew}, fs...)
+		file.stages = append([]streamStage{ew}, file.stages...)
+	}
+	if opt.compress {
+		gw := newGzipStreamWriter(out)
+		out = gw
+		fs = append(flushers{gw}, fs...)
+		file.stages = append([]streamStage{gw}, file.stages...)
+	}
+
+	bw := bufio.NewWriterSize(out, opt.bufioSize)
+	wc := &WriteCloseFlusher{
+		Writer:  bw,
+		Flusher: append(flushers{bw}, fs...),
+		Closer:  file,
+	}
+
+	if opt.encoding == BinaryEncoding {
+		dw := newBinaryDictWriter(bw)
+		wc.Writer = dw
+		file.stages = append([]streamStage{dw}, file.stages...)
+	} else if opt.hashChain {
+		wc.Writer = newHashChainWriter(bw, chainSeq, chainPrev)
+	}
+	return wc, nil
+}
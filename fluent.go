@@ -0,0 +1,265 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	fluentChunkSize     = 1024 * 1024 // 一个Forward批次的最大字节数
+	fluentMaxChunks     = 64          // 等待发送的批次上限, 超过后丢弃并计数
+	fluentAckTimeout    = 5 * time.Second
+	fluentCloseTimeout  = 5 * time.Second
+	fluentRecordMessage = "message" // 非json日志放入该字段
+)
+
+// fluentSink 定义工厂函数, URL格式:
+//
+//	fluent+tcp://host:24224?tag=app.x&ack=true
+//	fluent+unix:///var/run/fluent.sock
+//
+// tag 默认为进程名, ack 开启后等待服务端应答, 未应答的批次重连后重发, 保证至少一次送达
+func fluentSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := asyncConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newFluentWriter(u)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncLogSink(u.Redacted(), &WriteCloseFlusher{Writer: w, Closer: w, Flusher: w}, cfg), nil
+}
+
+// fluentChunk 一个Forward模式的批次
+type fluentChunk struct {
+	id      string
+	entries []byte // msgpack编码的 [time, record] 数组元素
+	count   int
+}
+
+// fluentWriter Fluent Forward协议输出
+// 异步写协程把日志编码进当前批次, Flush时交给发送协程, 发送协程负责重连、等待ack和重发
+type fluentWriter struct {
+	tag        string
+	nc         *netConn
+	ack        bool
+	ackTimeout time.Duration
+
+	cur     fluentChunk
+	chunks  chan *fluentChunk
+	dropped uint64
+
+	closing  chan struct{}
+	deadline time.Time // 关闭时发送剩余批次的截止时间
+	wg       sync.WaitGroup
+}
+
+func newFluentWriter(u *url.URL) (*fluentWriter, error) {
+	q := u.Query()
+	w := &fluentWriter{
+		tag:        processName(),
+		ackTimeout: fluentAckTimeout,
+		chunks:     make(chan *fluentChunk, fluentMaxChunks),
+		closing:    make(chan struct{}),
+	}
+	if tag := q.Get("tag"); tag != "" {
+		w.tag = tag
+	}
+	if v := q.Get("ack"); v != "" {
+		ack, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("zlog: invalid ack %q", v)
+		}
+		w.ack = ack
+	}
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("zlog: invalid timeout %q", v)
+		}
+		w.ackTimeout = d
+	}
+
+	switch u.Scheme {
+	case "fluent+tcp":
+		w.nc = newNetConn(u.Host, "tcp")
+	case "fluent+unix":
+		w.nc = newNetConn(u.Path, "unix")
+	default:
+		return nil, fmt.Errorf("zlog: unknown fluent scheme %q", u.Scheme)
+	}
+	if w.nc.addr == "" {
+		return nil, fmt.Errorf("zlog: fluent address required: %s", u)
+	}
+
+	w.wg.Add(1)
+	go w.sender()
+	return w, nil
+}
+
+// Write p 为一条json日志, 编码为 [EventTime, record] 加入当前批次, EventTime 为日志的时间字段
+func (w *fluentWriter) Write(p []byte) (n int, err error) {
+	line := bytes.TrimSuffix(p, []byte("\n"))
+	record, err := decodeLine(line)
+	if err != nil {
+		record = map[string]interface{}{fluentRecordMessage: string(line)}
+	}
+
+	w.cur.entries = appendMsgpackArrayHeader(w.cur.entries, 2)
+	w.cur.entries = appendMsgpackEventTime(w.cur.entries, recordTime(record))
+	w.cur.entries = appendMsgpack(w.cur.entries, record)
+	w.cur.count++
+	if len(w.cur.entries) >= fluentChunkSize {
+		w.cut()
+	}
+	return len(p), nil
+}
+
+// Flush 当前批次交给发送协程
+func (w *fluentWriter) Flush() error {
+	w.cut()
+	return nil
+}
+
+// Dropped 批次队列满或关闭超时丢弃的日志条数
+func (w *fluentWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close 发送剩余批次, 最多等待 fluentCloseTimeout
+func (w *fluentWriter) Close() error {
+	w.cut()
+	w.deadline = time.Now().Add(fluentCloseTimeout)
+	close(w.closing)
+	close(w.chunks)
+	w.wg.Wait()
+	return w.nc.Close()
+}
+
+func (w *fluentWriter) cut() {
+	if w.cur.count == 0 {
+		return
+	}
+	chunk := &fluentChunk{id: newChunkID(), entries: w.cur.entries, count: w.cur.count}
+	w.cur = fluentChunk{}
+	select {
+	case w.chunks <- chunk:
+	default:
+		atomic.AddUint64(&w.dropped, uint64(chunk.count))
+	}
+}
+
+func newChunkID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// sender 按顺序发送批次, 失败则退避重连后重发
+func (w *fluentWriter) sender() {
+	defer w.wg.Done()
+	for chunk := range w.chunks {
+		w.deliver(chunk)
+	}
+}
+
+func (w *fluentWriter) deliver(chunk *fluentChunk) {
+	msg := w.encode(chunk)
+	for {
+		if w.expired() {
+			atomic.AddUint64(&w.dropped, uint64(chunk.count))
+			return
+		}
+		conn, err := w.nc.get()
+		if err != nil {
+			w.wait(time.Until(w.nc.retryAt))
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(msg); err != nil {
+			w.nc.reset()
+			continue
+		}
+		if !w.ack {
+			return
+		}
+		if w.readAck(chunk.id) {
+			return
+		}
+		w.nc.reset()
+	}
+}
+
+// encode Forward模式: [tag, [[time, record], ...], {"chunk": id, "size": n}]
+func (w *fluentWriter) encode(chunk *fluentChunk) []byte {
+	b := make([]byte, 0, len(chunk.entries)+64)
+	b = appendMsgpackArrayHeader(b, 3)
+	b = appendMsgpackString(b, w.tag)
+	b = appendMsgpackArrayHeader(b, chunk.count)
+	b = append(b, chunk.entries...)
+	if w.ack {
+		b = appendMsgpackMapHeader(b, 2)
+		b = appendMsgpackString(b, "chunk")
+		b = appendMsgpackString(b, chunk.id)
+	} else {
+		b = appendMsgpackMapHeader(b, 1)
+	}
+	b = appendMsgpackString(b, "size")
+	return appendMsgpackInt(b, int64(chunk.count))
+}
+
+// readAck 等待服务端应答 {"ack": chunk}
+func (w *fluentWriter) readAck(id string) bool {
+	conn := w.nc.conn
+	conn.SetReadDeadline(time.Now().Add(w.ackTimeout))
+	v, err := readMsgpack(bufio.NewReader(conn))
+	if err != nil {
+		return false
+	}
+	resp, ok := v.(map[string]interface{})
+	return ok && resp["ack"] == id
+}
+
+// expired 关闭后超过截止时间则放弃发送
+func (w *fluentWriter) expired() bool {
+	select {
+	case <-w.closing:
+		return time.Now().After(w.deadline)
+	default:
+		return false
+	}
+}
+
+func (w *fluentWriter) wait(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-w.closing:
+		if time.Now().Before(w.deadline) {
+			time.Sleep(minDuration(d, time.Until(w.deadline)))
+		}
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
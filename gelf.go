@@ -0,0 +1,444 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// GELFEncoding GELF日志编码的名字, zap.Config.Encoding 使用
+const GELFEncoding = "gelf"
+
+const (
+	gelfVersion          = "1.1"
+	gelfDefaultChunkSize = 1420 // 适合公网MTU的udp分片大小
+	gelfMinChunkSize     = 64
+	gelfMaxChunkSize     = 8192
+	gelfMaxChunks        = 128
+	gelfChunkHeaderSize  = 12 // magic 2字节 | 消息id 8字节 | 序号 | 分片数
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+var errGELFTooLarge = errors.New("zlog: gelf message exceeds 128 chunks")
+
+func init() {
+	if err := zap.RegisterEncoder(GELFEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newGELFEncoder(), nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// gelfHostname GELF的host字段
+func gelfHostname() string {
+	if h, err := os.Hostname(); err == nil && h != "" {
+		return h
+	}
+	return processName()
+}
+
+// gelfKey 附加字段名加 _ 前缀, 非法字符替换为 _, _id 为保留字段
+func gelfKey(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			b[i] = '_'
+		}
+	}
+	key = string(b)
+	if !strings.HasPrefix(key, "_") {
+		key = "_" + key
+	}
+	if key == "_id" {
+		key = "_id_"
+	}
+	return key
+}
+
+// gelfTime GELF的timestamp为带小数的unix秒
+func gelfTime(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Millisecond)) / 1000
+}
+
+// gelfEncoder GELF 1.1 编码器, 在json编码器基础上给附加字段加 _ 前缀
+type gelfEncoder struct {
+	zapcore.Encoder
+	host string
+}
+
+func newGELFEncoder() *gelfEncoder {
+	cfg := zapcore.EncoderConfig{
+		MessageKey:     "short_message",
+		LevelKey:       "level",
+		TimeKey:        "timestamp",
+		NameKey:        "_logger",
+		CallerKey:      "_caller",
+		StacktraceKey:  "full_message",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) { enc.AppendInt(syslogSeverity(l)) },
+		EncodeTime:     func(t time.Time, enc zapcore.PrimitiveArrayEncoder) { enc.AppendFloat64(gelfTime(t)) },
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   callerEncoder,
+	}
+	return &gelfEncoder{Encoder: zapcore.NewJSONEncoder(cfg), host: gelfHostname()}
+}
+
+// AddArray .
+func (e *gelfEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	return e.Encoder.AddArray(gelfKey(key), marshaler)
+}
+
+// AddObject .
+func (e *gelfEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	return e.Encoder.AddObject(gelfKey(key), marshaler)
+}
+
+// AddBinary .
+func (e *gelfEncoder) AddBinary(key string, value []byte) { e.Encoder.AddBinary(gelfKey(key), value) }
+
+// AddByteString .
+func (e *gelfEncoder) AddByteString(key string, value []byte) {
+	e.Encoder.AddByteString(gelfKey(key), value)
+}
+
+// AddBool .
+func (e *gelfEncoder) AddBool(key string, value bool) { e.Encoder.AddBool(gelfKey(key), value) }
+
+// AddComplex128 .
+func (e *gelfEncoder) AddComplex128(key string, value complex128) {
+	e.Encoder.AddComplex128(gelfKey(key), value)
+}
+
+// AddComplex64 .
+func (e *gelfEncoder) AddComplex64(key string, value complex64) {
+	e.Encoder.AddComplex64(gelfKey(key), value)
+}
+
+// AddDuration .
+func (e *gelfEncoder) AddDuration(key string, value time.Duration) {
+	e.Encoder.AddDuration(gelfKey(key), value)
+}
+
+// AddFloat64 .
+func (e *gelfEncoder) AddFloat64(key string, value float64) {
+	e.Encoder.AddFloat64(gelfKey(key), value)
+}
+
+// AddFloat32 .
+func (e *gelfEncoder) AddFloat32(key string, value float32) {
+	e.Encoder.AddFloat32(gelfKey(key), value)
+}
+
+// AddInt .
+func (e *gelfEncoder) AddInt(key string, value int) { e.Encoder.AddInt(gelfKey(key), value) }
+
+// AddInt64 .
+func (e *gelfEncoder) AddInt64(key string, value int64) { e.Encoder.AddInt64(gelfKey(key), value) }
+
+// AddInt32 .
+func (e *gelfEncoder) AddInt32(key string, value int32) { e.Encoder.AddInt32(gelfKey(key), value) }
+
+// AddInt16 .
+func (e *gelfEncoder) AddInt16(key string, value int16) { e.Encoder.AddInt16(gelfKey(key), value) }
+
+// AddInt8 .
+func (e *gelfEncoder) AddInt8(key string, value int8) { e.Encoder.AddInt8(gelfKey(key), value) }
+
+// AddString .
+func (e *gelfEncoder) AddString(key, value string) { e.Encoder.AddString(gelfKey(key), value) }
+
+// AddTime .
+func (e *gelfEncoder) AddTime(key string, value time.Time) { e.Encoder.AddTime(gelfKey(key), value) }
+
+// AddUint .
+func (e *gelfEncoder) AddUint(key string, value uint) { e.Encoder.AddUint(gelfKey(key), value) }
+
+// AddUint64 .
+func (e *gelfEncoder) AddUint64(key string, value uint64) { e.Encoder.AddUint64(gelfKey(key), value) }
+
+// AddUint32 .
+func (e *gelfEncoder) AddUint32(key string, value uint32) { e.Encoder.AddUint32(gelfKey(key), value) }
+
+// AddUint16 .
+func (e *gelfEncoder) AddUint16(key string, value uint16) { e.Encoder.AddUint16(gelfKey(key), value) }
+
+// AddUint8 .
+func (e *gelfEncoder) AddUint8(key string, value uint8) { e.Encoder.AddUint8(gelfKey(key), value) }
+
+// AddUintptr .
+func (e *gelfEncoder) AddUintptr(key string, value uintptr) {
+	e.Encoder.AddUintptr(gelfKey(key), value)
+}
+
+// AddReflected .
+func (e *gelfEncoder) AddReflected(key string, value interface{}) error {
+	return e.Encoder.AddReflected(gelfKey(key), value)
+}
+
+// OpenNamespace .
+func (e *gelfEncoder) OpenNamespace(key string) { e.Encoder.OpenNamespace(gelfKey(key)) }
+
+// Clone .
+func (e *gelfEncoder) Clone() zapcore.Encoder {
+	return &gelfEncoder{Encoder: e.Encoder.Clone(), host: e.host}
+}
+
+// EncodeEntry 编码一条GELF消息, 以换行结尾
+func (e *gelfEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := e.Encoder.Clone()
+	final.AddString("version", gelfVersion)
+	final.AddString("host", e.host)
+	prefixed := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		f.Key = gelfKey(f.Key)
+		prefixed[i] = f
+	}
+	return final.EncodeEntry(ent, prefixed)
+}
+
+// lineToGELF 把json日志转换为GELF消息, 已经是GELF编码的日志原样返回
+func lineToGELF(line []byte, host string) []byte {
+	if bytes.Contains(line, []byte(`"short_message":`)) {
+		return line
+	}
+	record, err := decodeLine(line)
+	if err != nil {
+		record = map[string]interface{}{"msg": string(line)}
+	}
+
+	cfg := lineEncoderConfig()
+	msg := gelfMessage{Version: gelfVersion, Host: host, Timestamp: gelfTime(time.Now()), Level: syslogSeverity(zapcore.InfoLevel)}
+	extra := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		s, _ := v.(string)
+		switch k {
+		case cfg.MessageKey:
+			msg.ShortMessage = s
+		case cfg.StacktraceKey:
+			msg.FullMessage = s
+		case cfg.LevelKey:
+			if l, ok := textLevel(s); ok {
+				msg.Level = syslogSeverity(l)
+			}
+		case cfg.TimeKey:
+			if t, err := parseLogTime(s); err == nil {
+				msg.Timestamp = gelfTime(t)
+			}
+		case cfg.NameKey:
+			extra["_logger"] = v
+		default:
+			extra[gelfKey(k)] = v
+		}
+	}
+	if msg.ShortMessage == "" {
+		msg.ShortMessage = "-" // short_message为必填字段
+	}
+
+	b, _ := json.Marshal(msg)
+	if len(extra) > 0 {
+		e, _ := json.Marshal(extra)
+		b = append(b[:len(b)-1], ',')
+		b = append(b, e[1:]...)
+	}
+	return b
+}
+
+// gelfMessage GELF的标准字段
+type gelfMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	FullMessage  string  `json:"full_message,omitempty"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+}
+
+// gelfSink 定义工厂函数, URL格式:
+//
+//	gelf+udp://host:12201?compress=gzip&chunk=1420
+//	gelf+tcp://host:12201  tcp以空字节分隔消息, 不压缩
+//
+// compress 可选 gzip、zlib, 默认不压缩; chunk 为udp分片大小; host 为GELF的host字段, 默认主机名
+func gelfSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := asyncConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newGELFWriter(u)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncLogSink(u.Redacted(), &WriteCloseFlusher{Writer: w, Closer: w, Flusher: w}, cfg), nil
+}
+
+// gelfWriter GELF输出
+// 断线、超过128个分片的日志直接丢弃并计数
+type gelfWriter struct {
+	nc        *netConn
+	bw        *bufio.Writer // tcp连接的写缓存
+	bwConn    net.Conn      // bw当前绑定的连接
+	pending   uint64        // bw中未发送的日志条数
+	host      string
+	compress  string
+	chunkSize int
+	dropped   uint64
+	zbuf      bytes.Buffer
+	chunk     []byte
+}
+
+func newGELFWriter(u *url.URL) (*gelfWriter, error) {
+	q := u.Query()
+	w := &gelfWriter{
+		host:      gelfHostname(),
+		compress:  q.Get("compress"),
+		chunkSize: gelfDefaultChunkSize,
+	}
+	if h := q.Get("host"); h != "" {
+		w.host = h
+	}
+	switch w.compress {
+	case "", "none", "gzip", "zlib":
+	default:
+		return nil, fmt.Errorf("zlog: unknown gelf compress %q", w.compress)
+	}
+	if v := q.Get("chunk"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < gelfMinChunkSize || n > gelfMaxChunkSize {
+			return nil, fmt.Errorf("zlog: invalid gelf chunk %q", v)
+		}
+		w.chunkSize = n
+	}
+
+	switch u.Scheme {
+	case "gelf+udp":
+		w.nc = newNetConn(u.Host, "udp")
+	case "gelf+tcp":
+		w.nc = newNetConn(u.Host, "tcp")
+	default:
+		return nil, fmt.Errorf("zlog: unknown gelf scheme %q", u.Scheme)
+	}
+	if w.nc.addr == "" {
+		return nil, fmt.Errorf("zlog: gelf address required: %s", u)
+	}
+	return w, nil
+}
+
+// Write p 为一条日志, 连接不可用时丢弃并计数
+func (w *gelfWriter) Write(p []byte) (n int, err error) {
+	msg := lineToGELF(bytes.TrimSuffix(p, []byte("\n")), w.host)
+
+	conn, err := w.nc.get()
+	if err != nil {
+		atomic.AddUint64(&w.dropped, 1)
+		return len(p), nil
+	}
+
+	if !w.nc.stream() {
+		if err := w.writeDatagram(conn, msg); err != nil {
+			atomic.AddUint64(&w.dropped, 1)
+			if err != errGELFTooLarge {
+				w.nc.reset()
+			}
+		}
+		return len(p), nil
+	}
+
+	if w.bw == nil || w.bwConn != conn {
+		w.bw, w.bwConn = bufio.NewWriter(conn), conn
+		w.pending = 0
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout)) // bw写满时会直接写连接
+	w.bw.Write(msg)
+	w.bw.WriteByte(0)
+	w.pending++
+	return len(p), nil
+}
+
+// writeDatagram 压缩后发送, 超过分片大小则按GELF分片发送
+func (w *gelfWriter) writeDatagram(conn net.Conn, msg []byte) error {
+	if w.compress == "gzip" || w.compress == "zlib" {
+		w.zbuf.Reset()
+		var zw io.WriteCloser
+		if w.compress == "gzip" {
+			zw = gzip.NewWriter(&w.zbuf)
+		} else {
+			zw = zlib.NewWriter(&w.zbuf)
+		}
+		zw.Write(msg)
+		zw.Close()
+		msg = w.zbuf.Bytes()
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if len(msg) <= w.chunkSize {
+		_, err := conn.Write(msg)
+		return err
+	}
+
+	size := w.chunkSize - gelfChunkHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return errGELFTooLarge
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		w.chunk = append(w.chunk[:0], gelfChunkMagic...)
+		w.chunk = append(w.chunk, id[:]...)
+		w.chunk = append(w.chunk, byte(i), byte(count))
+		w.chunk = append(w.chunk, msg[i*size:end]...)
+		if _, err := conn.Write(w.chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush 发送tcp连接缓存的日志
+func (w *gelfWriter) Flush() error {
+	if w.bw == nil || w.bwConn == nil || w.bw.Buffered() == 0 {
+		return nil
+	}
+	w.bwConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := w.bw.Flush(); err != nil {
+		atomic.AddUint64(&w.dropped, w.pending)
+		w.nc.reset()
+		w.bw, w.bwConn, w.pending = nil, nil, 0
+		return nil
+	}
+	w.pending = 0
+	return nil
+}
+
+// Dropped 断线、消息过大等原因丢弃的日志条数
+func (w *gelfWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close 发送剩余日志并关闭连接
+func (w *gelfWriter) Close() error {
+	w.Flush()
+	return w.nc.Close()
+}
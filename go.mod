@@ -4,11 +4,12 @@ go 1.17
 
 require (
 	github.com/v2pro/plz v0.0.0-20200805122259-422184e41b6e
+	go.uber.org/multierr v1.6.0
 	go.uber.org/zap v1.21.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	go.uber.org/atomic v1.7.0 // indirect
-	go.uber.org/multierr v1.6.0 // indirect
 )
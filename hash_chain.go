@@ -0,0 +1,285 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	logChainKeySeq  = "seq"
+	logChainKeyHash = "hash"
+)
+
+// 行尾追加的哈希链字段: ,"seq":N,"hash":"sha256hex"}
+var chainSuffixRe = regexp.MustCompile(`,"` + logChainKeySeq + `":(\d+),"` + logChainKeyHash + `":"([0-9a-f]{64})"}$`)
+
+// hashChainWriter 防篡改哈希链
+// 每行日志追加序号seq和哈希hash, hash = sha256(上一行hash + 本行原始内容),
+// 任意一行被修改、删除或插入都会使其后的链接校验失败
+type hashChainWriter struct {
+	w    io.Writer
+	seq  uint64
+	prev string // 上一行的hash, 十六进制
+}
+
+// newHashChainWriter 创建哈希链写入器, 从已有日志的最后一个节点(见 lastChainLink)续接哈希链, 保证重启和滚动后链不断开
+func newHashChainWriter(w io.Writer, seq uint64, prev string) *hashChainWriter {
+	return &hashChainWriter{w: w, seq: seq, prev: prev}
+}
+
+// Write p 为一条完整的json日志
+func (h *hashChainWriter) Write(p []byte) (n int, err error) {
+	line := bytes.TrimSuffix(p, []byte("\n"))
+	if !bytes.HasSuffix(line, []byte("}")) {
+		return h.w.Write(p)
+	}
+
+	h.seq++
+	h.prev = chainHash(h.prev, line)
+
+	b := make([]byte, 0, len(line)+len(h.prev)+32)
+	b = append(b, line[:len(line)-1]...)
+	b = append(b, fmt.Sprintf(",\"%s\":%d,\"%s\":\"%s\"}\n", logChainKeySeq, h.seq, logChainKeyHash, h.prev)...)
+	if _, err := h.w.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// chainHash 计算本行的链式哈希
+func chainHash(prev string, line []byte) string {
+	s := sha256.New()
+	s.Write([]byte(prev))
+	s.Write(line)
+	return hex.EncodeToString(s.Sum(nil))
+}
+
+// parseChainLine 拆出日志行的原始内容和哈希链字段
+func parseChainLine(line []byte) (raw []byte, seq uint64, hash string, ok bool) {
+	m := chainSuffixRe.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, 0, "", false
+	}
+	seq, err := strconv.ParseUint(string(line[m[2]:m[3]]), 10, 64)
+	if err != nil {
+		return nil, 0, "", false
+	}
+	raw = make([]byte, 0, m[0]+1)
+	raw = append(raw, line[:m[0]]...)
+	raw = append(raw, '}')
+	return raw, seq, string(line[m[4]:m[5]]), true
+}
+
+// lastChainLink 查找当前日志文件及其滚动备份中最后一个哈希链节点
+func lastChainLink(filePath string, key []byte) (uint64, string, error) {
+	for _, path := range chainResumeFiles(filePath) {
+		seq, hash, err := lastChainLinkInFile(path, key)
+		if err != nil {
+			return 0, "", err
+		}
+		if seq > 0 {
+			return seq, hash, nil
+		}
+	}
+	return 0, "", nil
+}
+
+// chainResumeFiles 续接哈希链的候选文件: 当前文件优先, 其次按修改时间从新到旧的滚动备份.
+// 未压缩的备份仍在时对应的gz正在由lumberjack压缩, 跳过gz
+func chainResumeFiles(filePath string) []string {
+	ext := filepath.Ext(filePath)
+	prefix := strings.TrimSuffix(filepath.Base(filePath), ext) + "-"
+	entries, _ := os.ReadDir(filepath.Dir(filePath))
+
+	type backup struct {
+		path  string
+		mtime int64
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if !strings.HasSuffix(name, ext) && !strings.HasSuffix(name, ext+".gz") {
+			continue
+		}
+		if strings.HasSuffix(name, ".gz") {
+			if _, err := os.Stat(filepath.Join(filepath.Dir(filePath), strings.TrimSuffix(name, ".gz"))); err == nil {
+				continue
+			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{filepath.Join(filepath.Dir(filePath), name), info.ModTime().UnixNano()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].mtime > backups[j].mtime })
+
+	files := []string{filePath}
+	for _, b := range backups {
+		files = append(files, b.path)
+	}
+	return files
+}
+
+func lastChainLinkInFile(path string, key []byte) (seq uint64, hash string, err error) {
+	r, err := OpenLogFile(path, key)
+	if os.IsNotExist(err) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	sc := newLineScanner(r)
+	for sc.Scan() {
+		if _, s, h, ok := parseChainLine(sc.Bytes()); ok {
+			seq, hash = s, h
+		}
+	}
+	return seq, hash, nil
+}
+
+// ChainBreak 哈希链校验失败的位置
+type ChainBreak struct {
+	File   string // 文件路径
+	Line   int    // 行号, 从1开始
+	Seq    uint64 // 期望的序号
+	Reason string // 失败原因
+}
+
+func (b *ChainBreak) Error() string {
+	return fmt.Sprintf("%s:%d: hash chain broken at seq %d: %s", b.File, b.Line, b.Seq, b.Reason)
+}
+
+type chainFile struct {
+	path     string
+	firstSeq uint64
+}
+
+// VerifyHashChain 校验一组日志文件(可以是gzip压缩的滚动文件)的哈希链, 未加密的文件key传nil.
+// 文件按首行序号排序后首尾相接校验, 链必须从seq 1开始, 返回第一个断开的链接, 全部通过返回nil.
+func VerifyHashChain(paths []string, key []byte) (*ChainBreak, error) {
+	return VerifyHashChainFrom(paths, key, 1)
+}
+
+// VerifyHashChainFrom 同 VerifyHashChain, 链从序号start开始, 用于较早的滚动文件已按保留策略删除的情况.
+// start大于1时首行无法得知上一行的hash, 作为校验起点; 首行序号不是start时报告实际的起点, 头部截断不会被忽略
+func VerifyHashChainFrom(paths []string, key []byte, start uint64) (*ChainBreak, error) {
+	files := make([]chainFile, 0, len(paths))
+	for _, path := range paths {
+		seq, err := firstChainSeq(path, key)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, chainFile{path: path, firstSeq: seq})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].firstSeq < files[j].firstSeq })
+
+	v := &chainVerifier{start: start}
+	for _, f := range files {
+		if brk, err := v.verifyFile(f.path, key); brk != nil || err != nil {
+			return brk, err
+		}
+	}
+	return nil, nil
+}
+
+func firstChainSeq(path string, key []byte) (uint64, error) {
+	r, err := OpenLogFile(path, key)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	sc := newLineScanner(r)
+	for sc.Scan() {
+		if _, seq, _, ok := parseChainLine(sc.Bytes()); ok {
+			return seq, nil
+		}
+	}
+	if err := sc.Err(); !errors.Is(err, ErrLogUnfinished) {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// chainVerifier 跨文件的哈希链校验状态
+type chainVerifier struct {
+	start   uint64 // 期望的首行序号
+	started bool
+	seq     uint64
+	prev    string
+}
+
+func (v *chainVerifier) verifyFile(path string, key []byte) (*ChainBreak, error) {
+	r, err := OpenLogFile(path, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	sc := newLineScanner(r)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		brk := &ChainBreak{File: path, Line: lineNum, Seq: v.seq + 1}
+
+		raw, seq, hash, ok := parseChainLine(line)
+		if !ok {
+			brk.Reason = "missing seq/hash fields"
+			return brk, nil
+		}
+		if !v.started {
+			if seq != v.start {
+				brk.Seq = v.start
+				brk.Reason = fmt.Sprintf("chain starts at seq %d, records before it are missing", seq)
+				return brk, nil
+			}
+			// 首行无法得知上一行的hash, 作为校验起点
+			v.started, v.seq, v.prev = true, seq, hash
+			if seq == 1 && chainHash("", raw) != hash {
+				brk.Reason = "hash mismatch"
+				return brk, nil
+			}
+			continue
+		}
+		if seq != v.seq+1 {
+			brk.Reason = fmt.Sprintf("unexpected seq %d", seq)
+			return brk, nil
+		}
+		if chainHash(v.prev, raw) != hash {
+			brk.Reason = "hash mismatch"
+			return brk, nil
+		}
+		v.seq, v.prev = seq, hash
+	}
+	if err := sc.Err(); !errors.Is(err, ErrLogUnfinished) {
+		return nil, err
+	}
+	// 正在写入的加密文件没有结束块, 滚动文件末尾被截断时下一个文件的首行序号会断开
+	return nil, nil
+}
+
+// newLineScanner 按行读取日志, 支持超长行
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+	return sc
+}
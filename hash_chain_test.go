@@ -0,0 +1,120 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func hashChainOptions(path string) *Options {
+	opt := defaultOptions
+	opt.logPath = path
+	opt.hashChain = true
+	return &opt
+}
+
+// writeChainLines 写入json日志行, 内容为 n=from..to
+func writeChainLines(t *testing.T, wc *WriteCloseFlusher, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		if _, err := wc.Write([]byte(fmt.Sprintf(`{"level":"info","msg":"enter room","n":%d}`+"\n", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashChainVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "room.log")
+	wc, err := newFileWriter(hashChainOptions(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChainLines(t, wc, 1, 5)
+	wc.Close()
+
+	if brk, err := VerifyHashChain([]string{path}, nil); brk != nil || err != nil {
+		t.Fatalf("intact chain: %v %v", brk, err)
+	}
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(orig, []byte("\n"))
+
+	cases := []struct {
+		name   string
+		data   []byte
+		reason string
+	}{
+		{"edited", bytes.Replace(orig, []byte(`"n":3`), []byte(`"n":9`), 1), "hash mismatch"},
+		{"removed", bytes.Join(append(lines[:2:2], lines[3:]...), nil), "unexpected seq 4"},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(path, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		brk, err := VerifyHashChain([]string{path}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if brk == nil || brk.Line != 3 || brk.Seq != 3 || brk.Reason != c.reason {
+			t.Errorf("%s: break = %+v, want line 3 seq 3 %q", c.name, brk, c.reason)
+		}
+	}
+}
+
+// 滚动后的备份由lumberjack在后台gzip, 重启时从备份续接, 校验跨越gz备份和当前文件
+func TestHashChainGzipRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "room.log")
+	opt := hashChainOptions(path)
+
+	wc, err := newFileWriter(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc.Closer.(*fileSink).limit = 1 // 下一次Flush时滚动
+	writeChainLines(t, wc, 1, 3)
+	wc.Close()
+	// 等待压缩完成再打开: 新的lumberjack写入时同样会压缩该备份, 两者同时压缩时失败的一方删除gz
+	backups := waitCompressed(t, dir)
+
+	// 当前文件为空, 从gz备份续接
+	wc, err = newFileWriter(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChainLines(t, wc, 4, 5)
+	wc.Close()
+
+	brk, err := VerifyHashChain(append(backups, path), nil)
+	if brk != nil || err != nil {
+		t.Fatalf("chain across gzip rotation: %v %v", brk, err)
+	}
+	if seq, _, err := lastChainLink(path, nil); err != nil || seq != 5 {
+		t.Errorf("last seq = %d %v, want 5", seq, err)
+	}
+}
+
+// waitCompressed 等待lumberjack在后台压缩滚动的备份, 返回gz备份
+func waitCompressed(t *testing.T, dir string) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		gz, _ := filepath.Glob(filepath.Join(dir, "room-*.log.gz"))
+		plain, _ := filepath.Glob(filepath.Join(dir, "room-*.log"))
+		if len(gz) == 1 && len(plain) == 0 {
+			return gz
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backup not compressed: %v %v", gz, plain)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,422 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFallbackPath  = "./log/%s/%s.fallback.log"
+	defaultBatchSize     = 1024 * 1024 // 批量发送的字节数
+	defaultBatchInterval = time.Second // 批量发送的最长间隔
+	defaultMaxRetries    = 5
+	defaultBatchQueue    = 4 // 等待发送的满批次数
+	defaultHTTPTimeout   = 10 * time.Second
+	retryBaseDelay       = 200 * time.Millisecond
+	retryMaxDelay        = 10 * time.Second
+)
+
+// BatchEntry 批量发送的一条日志
+type BatchEntry struct {
+	Time time.Time // 日志的时间字段, 不是json时为进入批次的时间
+	Line []byte    // 编码后的一条日志, 不含换行
+}
+
+// BatchFormat HTTP批量发送的请求体格式
+type BatchFormat interface {
+	// ContentType 请求体的Content-Type
+	ContentType() string
+	// Encode 把一批日志编码为请求体
+	Encode(w io.Writer, entries []BatchEntry) error
+}
+
+var (
+	batchFormatsMu sync.RWMutex
+	batchFormats   = map[string]func(q url.Values) (BatchFormat, error){
+		"ndjson": newNDJSONFormat,
+		"push":   newPushFormat,
+	}
+)
+
+// RegisterBatchFormat 注册HTTP批量发送的请求体格式, 通过URL参数 format=name 选择,
+// 构造函数可以读取URL的其余参数
+func RegisterBatchFormat(name string, factory func(q url.Values) (BatchFormat, error)) {
+	batchFormatsMu.Lock()
+	defer batchFormatsMu.Unlock()
+	batchFormats[name] = factory
+}
+
+// ndjsonFormat Elasticsearch风格的bulk请求体, 每条日志前加一行index动作
+type ndjsonFormat struct {
+	action []byte
+}
+
+func newNDJSONFormat(q url.Values) (BatchFormat, error) {
+	action := map[string]map[string]string{"index": {}}
+	if index := q.Get("index"); index != "" {
+		action["index"]["_index"] = index
+	}
+	b, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonFormat{action: append(b, '\n')}, nil
+}
+
+func (f *ndjsonFormat) ContentType() string { return "application/x-ndjson" }
+
+func (f *ndjsonFormat) Encode(w io.Writer, entries []BatchEntry) error {
+	for _, e := range entries {
+		w.Write(f.action)
+		w.Write(e.Line)
+		if _, err := w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushFormat Loki风格的push请求体:
+// {"streams":[{"stream":{标签},"values":[["纳秒时间戳","日志"],...]}]}
+// 标签通过URL参数 label.name=value 设置, 默认 app=进程名
+type pushFormat struct {
+	labels map[string]string
+}
+
+func newPushFormat(q url.Values) (BatchFormat, error) {
+	labels := map[string]string{"app": processName()}
+	for k, v := range q {
+		if strings.HasPrefix(k, "label.") && len(v) > 0 {
+			labels[strings.TrimPrefix(k, "label.")] = v[0]
+		}
+	}
+	return &pushFormat{labels: labels}, nil
+}
+
+func (f *pushFormat) ContentType() string { return "application/json" }
+
+func (f *pushFormat) Encode(w io.Writer, entries []BatchEntry) error {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	s := stream{Stream: f.labels, Values: make([][2]string, 0, len(entries))}
+	for _, e := range entries {
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), string(e.Line)})
+	}
+	return json.NewEncoder(w).Encode(map[string][]stream{"streams": {s}})
+}
+
+// httpSink 定义工厂函数, URL格式:
+//
+//	bulk+http://host:9200/_bulk?format=ndjson&index=app
+//	bulk+https://host/loki/api/v1/push?format=push&label.env=prod
+//	otlp+http://collector:4318?service=room   格式为otlp, 路径默认为 /v1/logs
+//
+// 其余参数: batch 批量字节数, interval 批量最长间隔, retries 重试次数, fallback 发送失败后写入的本地文件
+func httpSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := asyncConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := *u
+	endpoint.Scheme = u.Scheme[strings.Index(u.Scheme, "+")+1:]
+
+	format := u.Query().Get("format")
+	switch {
+	case format != "":
+	case strings.HasPrefix(u.Scheme, "otlp+"):
+		format = "otlp"
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = otlpLogsPath
+		}
+	default:
+		format = "ndjson"
+	}
+	batchFormatsMu.RLock()
+	factory, ok := batchFormats[format]
+	batchFormatsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("zlog: unknown batch format %q", format)
+	}
+	f, err := factory(u.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newHTTPShipper(&endpoint, f)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncLogSink(u.Redacted(), &WriteCloseFlusher{Writer: w, Closer: w, Flusher: w}, cfg), nil
+}
+
+// errBatchBacklog 发送协程积压, 满批次直接写入fallback文件
+var errBatchBacklog = errors.New("zlog: http sink backlog full")
+
+// httpShipper 按大小和时间批量发送日志, 由后台协程按顺序发送, 不阻塞异步写协程.
+// 请求体gzip压缩, 失败按指数退避加随机抖动重试, 重试耗尽或积压时写入本地fallback文件
+type httpShipper struct {
+	endpoint   string
+	client     *http.Client
+	format     BatchFormat
+	batchSize  int
+	interval   time.Duration
+	maxRetries int
+
+	mu      sync.Mutex
+	entries []BatchEntry
+	size    int
+	first   time.Time
+
+	batches chan []BatchEntry // 满批次, 交给发送协程
+
+	fallbackMu   sync.Mutex
+	fallbackPath string
+	fallback     *os.File
+	failed       uint64 // 写入fallback的日志条数
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// endpoint 为去掉zlog参数后的请求地址
+func newHTTPShipper(endpoint *url.URL, format BatchFormat) (*httpShipper, error) {
+	q := endpoint.Query()
+	h := &httpShipper{
+		client:       &http.Client{Timeout: defaultHTTPTimeout},
+		format:       format,
+		batchSize:    defaultBatchSize,
+		interval:     defaultBatchInterval,
+		maxRetries:   defaultMaxRetries,
+		fallbackPath: fmt.Sprintf(defaultFallbackPath, processName(), processName()),
+		batches:      make(chan []BatchEntry, defaultBatchQueue),
+		done:         make(chan struct{}),
+	}
+	if v := q.Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("zlog: invalid batch %q", v)
+		}
+		h.batchSize = n
+	}
+	if v := q.Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("zlog: invalid interval %q", v)
+		}
+		h.interval = d
+	}
+	if v := q.Get("retries"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("zlog: invalid retries %q", v)
+		}
+		h.maxRetries = n
+	}
+	if v := q.Get("fallback"); v != "" {
+		h.fallbackPath = v
+	}
+	// 其余参数属于请求体格式或服务端
+	for _, k := range []string{"format", "batch", "interval", "retries", "fallback", "buffer", "overflow"} {
+		q.Del(k)
+	}
+	endpoint.RawQuery = q.Encode()
+	h.endpoint = endpoint.String()
+
+	h.wg.Add(1)
+	go h.run()
+	return h, nil
+}
+
+// Write p 为一条日志, 批次达到大小则交给发送协程. p由异步管道拷贝后独占, 直接保留不再拷贝
+func (h *httpShipper) Write(p []byte) (n int, err error) {
+	line := bytes.TrimSuffix(p, []byte("\n"))
+
+	when := lineTime(line)
+	h.mu.Lock()
+	if len(h.entries) == 0 {
+		h.first = time.Now() // 批次的等待时间按进入批次计算
+	}
+	h.entries = append(h.entries, BatchEntry{Time: when, Line: line})
+	h.size += len(line)
+	full := h.size >= h.batchSize
+	h.mu.Unlock()
+
+	if full {
+		entries := h.take()
+		select {
+		case h.batches <- entries:
+		default:
+			// 服务端故障时发送协程在重试, 不阻塞异步写协程
+			h.writeFallback(entries, errBatchBacklog)
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 异步写协程管道为空时调用, 批次按时间发送, 这里不立即发送
+func (h *httpShipper) Flush() error {
+	return nil
+}
+
+// Dropped 发送失败转入fallback文件的日志条数
+func (h *httpShipper) Dropped() uint64 {
+	return atomic.LoadUint64(&h.failed)
+}
+
+// Close 发送剩余日志, 可重复调用
+func (h *httpShipper) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		close(h.done)
+		h.wg.Wait()
+
+		h.fallbackMu.Lock()
+		defer h.fallbackMu.Unlock()
+		if h.fallback != nil {
+			err = h.fallback.Close()
+		}
+	})
+	return err
+}
+
+// run 按顺序发送满批次和超过间隔的批次, 关闭时发送剩余日志
+func (h *httpShipper) run() {
+	defer h.wg.Done()
+	t := time.NewTicker(h.interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case entries := <-h.batches:
+			h.send(entries)
+		case <-t.C:
+			h.mu.Lock()
+			due := len(h.entries) > 0 && time.Since(h.first) >= h.interval
+			h.mu.Unlock()
+			if due {
+				h.send(h.take())
+			}
+		case <-h.done:
+			for {
+				select {
+				case entries := <-h.batches:
+					h.send(entries)
+				default:
+					h.send(h.take())
+					return
+				}
+			}
+		}
+	}
+}
+
+// take 取出当前批次
+func (h *httpShipper) take() []BatchEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := h.entries
+	h.entries, h.size = nil, 0
+	return entries
+}
+
+// send 发送一个批次, 重试耗尽后写入fallback文件, 只在发送协程中调用
+func (h *httpShipper) send(entries []BatchEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	err := h.format.Encode(zw, entries)
+	if err == nil {
+		err = zw.Close()
+	}
+
+	for attempt := 0; err == nil; attempt++ {
+		var retry bool
+		if retry, err = h.post(body.Bytes()); err == nil || !retry || attempt >= h.maxRetries {
+			break
+		}
+		time.Sleep(retryDelay(attempt))
+	}
+	if err != nil {
+		h.writeFallback(entries, err)
+	}
+}
+
+// post 发送请求, 返回失败是否可以重试
+func (h *httpShipper) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, h.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", h.format.ContentType())
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("zlog: http status %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// retryDelay 指数退避加全随机抖动
+func retryDelay(attempt int) time.Duration {
+	d := retryBaseDelay << uint(attempt)
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d))) + time.Millisecond
+}
+
+// writeFallback 发送失败的批次按行写入本地文件
+func (h *httpShipper) writeFallback(entries []BatchEntry, cause error) {
+	atomic.AddUint64(&h.failed, uint64(len(entries)))
+	h.fallbackMu.Lock()
+	defer h.fallbackMu.Unlock()
+	if h.fallback == nil {
+		if err := os.MkdirAll(filepath.Dir(h.fallbackPath), 0755); err != nil {
+			fmt.Fprintln(os.Stderr, "zlog: http sink fallback:", err, cause)
+			return
+		}
+		f, err := os.OpenFile(h.fallbackPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.FileMode(0644))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zlog: http sink fallback:", err, cause)
+			return
+		}
+		h.fallback = f
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.Write(e.Line)
+		buf.WriteByte('\n')
+	}
+	h.fallback.Write(buf.Bytes())
+}
@@ -0,0 +1,176 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	journalDefaultSocket = "/run/systemd/journal/socket"
+	journalMaxKeyLen     = 64
+)
+
+var errJournalFdUnsupported = errors.New("zlog: journald large entry needs memfd, unsupported on this platform")
+
+// journaldSink 定义工厂函数, URL格式:
+//
+//	journald://                         默认 /run/systemd/journal/socket
+//	journald:///tmp/journal.sock?identifier=room
+//
+// identifier 为 SYSLOG_IDENTIFIER, 默认进程名
+func journaldSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := asyncConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	w := newJournalWriter(u)
+	return newAsyncLogSink(u.Redacted(), &WriteCloseFlusher{Writer: w, Closer: w, Flusher: w}, cfg), nil
+}
+
+// journalWriter systemd-journald原生协议输出, 每条日志一个数据报
+// 数据报超过socket上限时写入memfd, 通过SCM_RIGHTS发送文件描述符
+type journalWriter struct {
+	nc         *netConn
+	identifier string
+	dropped    uint64
+	msg        []byte
+}
+
+func newJournalWriter(u *url.URL) *journalWriter {
+	w := &journalWriter{identifier: processName()}
+	path := u.Path
+	if path == "" || path == "/" {
+		path = journalDefaultSocket
+	}
+	if id := u.Query().Get("identifier"); id != "" {
+		w.identifier = id
+	}
+	w.nc = newNetConn(path, "unixgram")
+	return w
+}
+
+// journalKey 字段名转换为journald的字段名: 大写字母、数字、下划线, 不以下划线和数字开头
+func journalKey(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	b = bytes.TrimLeft(b, "_")
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		b = append([]byte("F_"), b...)
+	}
+	if len(b) > journalMaxKeyLen {
+		b = b[:journalMaxKeyLen]
+	}
+	return string(b)
+}
+
+// appendJournalField 写入一个字段, 值含换行时使用二进制格式: KEY\n 小端uint64长度 值\n
+func appendJournalField(b []byte, key string, value []byte) []byte {
+	if key == "" {
+		return b
+	}
+	b = append(b, key...)
+	if bytes.IndexByte(value, '\n') < 0 {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b = append(b, size[:]...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// format 把一条json日志转换为journald字段, 非json日志整行作为MESSAGE
+func (w *journalWriter) format(line []byte) []byte {
+	w.msg = w.msg[:0]
+	w.msg = appendJournalField(w.msg, "SYSLOG_IDENTIFIER", []byte(w.identifier))
+	w.msg = appendJournalField(w.msg, "PRIORITY", []byte(strconv.Itoa(syslogSeverity(recordLevel(line)))))
+
+	record, err := decodeLine(line)
+	if err != nil {
+		return appendJournalField(w.msg, "MESSAGE", line)
+	}
+
+	cfg := lineEncoderConfig()
+	for k, v := range record {
+		s, isString := v.(string)
+		switch k {
+		case cfg.LevelKey, cfg.TimeKey:
+			// journald自己记录时间, level转换为PRIORITY
+		case cfg.MessageKey:
+			w.msg = appendJournalField(w.msg, "MESSAGE", []byte(s))
+		case cfg.CallerKey:
+			file, lineNum, fn := splitCaller(s)
+			w.msg = appendJournalField(w.msg, "CODE_FILE", []byte(file))
+			w.msg = appendJournalField(w.msg, "CODE_LINE", []byte(strconv.Itoa(lineNum)))
+			w.msg = appendJournalField(w.msg, "CODE_FUNC", []byte(fn))
+		case cfg.StacktraceKey:
+			w.msg = appendJournalField(w.msg, "STACKTRACE", []byte(s))
+		case cfg.NameKey:
+			w.msg = appendJournalField(w.msg, "LOGGER", []byte(s))
+		default:
+			if isString {
+				w.msg = appendJournalField(w.msg, journalKey(k), []byte(s))
+			} else if b, err := json.Marshal(v); err == nil {
+				w.msg = appendJournalField(w.msg, journalKey(k), b)
+			}
+		}
+	}
+	return w.msg
+}
+
+// Write p 为一条日志, 连接不可用时丢弃并计数
+func (w *journalWriter) Write(p []byte) (n int, err error) {
+	msg := w.format(bytes.TrimSuffix(p, []byte("\n")))
+
+	conn, err := w.nc.get()
+	if err != nil {
+		atomic.AddUint64(&w.dropped, 1)
+		return len(p), nil
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = conn.Write(msg)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = sendJournalFd(conn.(*net.UnixConn), msg)
+	}
+	if err != nil {
+		atomic.AddUint64(&w.dropped, 1)
+		if err != errJournalFdUnsupported {
+			w.nc.reset()
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 数据报直接发送, 无缓存
+func (w *journalWriter) Flush() error {
+	return nil
+}
+
+// Dropped 断线、发送失败等原因丢弃的日志条数
+func (w *journalWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close 关闭连接
+func (w *journalWriter) Close() error {
+	return w.nc.Close()
+}
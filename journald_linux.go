@@ -0,0 +1,101 @@
+package zlog
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	fSealAll        = 0x1 | 0x2 | 0x4 | 0x8 // SEAL, SHRINK, GROW, WRITE
+)
+
+// sysMemfdCreate memfd_create的系统调用号, syscall包未导出
+var sysMemfdCreate = map[string]uintptr{
+	"amd64": 319,
+	"386":   356,
+	"arm64": 279,
+	"arm":   385,
+}
+
+// sendJournalFd 日志写入memfd, 只发送文件描述符
+func sendJournalFd(conn *net.UnixConn, msg []byte) error {
+	fd, err := journalFile(msg)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// 连接的数据报socket不能用WriteMsgUnix, 直接sendmsg
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	werr := rc.Write(func(s uintptr) bool {
+		err = syscall.Sendmsg(int(s), nil, syscall.UnixRights(fd), nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+// journalFile 日志写入封印的memfd, 不支持memfd时使用/dev/shm中删除了路径的临时文件, 同sd_journal_sendv
+func journalFile(msg []byte) (int, error) {
+	if fd, err := memfdCreate("zlog-journal"); err == nil {
+		if err := writeAll(fd, msg); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), fAddSeals, fSealAll); errno != 0 {
+			syscall.Close(fd)
+			return -1, errno
+		}
+		return fd, nil
+	}
+
+	f, err := ioutil.TempFile("/dev/shm", "zlog-journal-")
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+	if _, err := f.Write(msg); err != nil {
+		return -1, err
+	}
+	return syscall.Dup(int(f.Fd()))
+}
+
+func memfdCreate(name string) (int, error) {
+	trap, ok := sysMemfdCreate[runtime.GOARCH]
+	if !ok {
+		return -1, syscall.ENOSYS
+	}
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(p)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func writeAll(fd int, b []byte) error {
+	for len(b) > 0 {
+		n, err := syscall.Write(fd, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
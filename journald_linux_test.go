@@ -0,0 +1,147 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// parseJournalEntry 解析journald原生协议的一条日志: KEY=value\n 或 KEY\n 小端uint64长度 value\n
+func parseJournalEntry(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			t.Fatalf("bad journal entry tail %q", b)
+		}
+		key := string(b[:i])
+		if b[i] == '=' {
+			j := bytes.IndexByte(b, '\n')
+			fields[key] = string(b[i+1 : j])
+			b = b[j+1:]
+			continue
+		}
+		b = b[i+1:]
+		if len(b) < 8 {
+			t.Fatalf("bad journal field %s", key)
+		}
+		size := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		if uint64(len(b)) < size+1 || b[size] != '\n' {
+			t.Fatalf("bad journal field %s size %d", key, size)
+		}
+		fields[key] = string(b[:size])
+		b = b[size+1:]
+	}
+	return fields
+}
+
+// readJournal 读取一个数据报, 带有文件描述符时读取memfd的内容
+func readJournal(t *testing.T, conn *net.UnixConn) (entry []byte, viaFd bool) {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oobn == 0 {
+		return buf[:n], false
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("control message: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("unix rights: %v", err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+	// journald按偏移0映射文件, 写入后文件偏移在末尾
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if _, err := b.ReadFrom(f); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("datagram with fd carries %d bytes", n)
+	}
+	return b.Bytes(), true
+}
+
+func TestJournald(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	u, _ := url.Parse("journald://" + path + "?identifier=room")
+	w := newJournalWriter(u)
+	defer w.Close()
+
+	// 普通日志一个数据报, 含换行的值使用二进制格式
+	w.Write([]byte(`{"level":"warn","time":"2024-05-06T07:08:09Z","caller":"room/room.go:42:Enter","msg":"enter room","stack":"a\nb","uid":10086}` + "\n"))
+	entry, viaFd := readJournal(t, conn)
+	if viaFd {
+		t.Error("small entry sent via fd")
+	}
+	fields := parseJournalEntry(t, entry)
+	want := map[string]string{
+		"SYSLOG_IDENTIFIER": "room",
+		"PRIORITY":          "4",
+		"MESSAGE":           "enter room",
+		"CODE_FILE":         "room/room.go",
+		"CODE_LINE":         "42",
+		"CODE_FUNC":         "Enter",
+		"STACKTRACE":        "a\nb",
+		"UID":               "10086",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, fields[k], v)
+		}
+	}
+	if _, ok := fields["TIME"]; ok {
+		t.Error("time field forwarded")
+	}
+
+	// 超过数据报上限的日志写入memfd后发送文件描述符, 不支持memfd时使用/dev/shm的临时文件
+	big := strings.Repeat("x", 4*1024*1024)
+	for _, memfd := range []bool{true, false} {
+		if !memfd {
+			if _, err := os.Stat("/dev/shm"); err != nil {
+				t.Skip("no /dev/shm")
+			}
+			trap := sysMemfdCreate[runtime.GOARCH]
+			delete(sysMemfdCreate, runtime.GOARCH)
+			defer func() { sysMemfdCreate[runtime.GOARCH] = trap }()
+		}
+		w.Write([]byte(`{"level":"error","msg":"` + big + `"}` + "\n"))
+		entry, viaFd = readJournal(t, conn)
+		if !viaFd {
+			t.Fatalf("memfd %v: large entry not sent via fd", memfd)
+		}
+		fields = parseJournalEntry(t, entry)
+		if fields["MESSAGE"] != big || fields["PRIORITY"] != "3" {
+			t.Errorf("memfd %v: MESSAGE %d bytes, PRIORITY %q", memfd, len(fields["MESSAGE"]), fields["PRIORITY"])
+		}
+	}
+	if n := w.Dropped(); n != 0 {
+		t.Errorf("dropped %d", n)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package zlog
+
+import "net"
+
+// sendJournalFd 非linux平台没有memfd, 超长的日志丢弃
+func sendJournalFd(conn *net.UnixConn, msg []byte) error {
+	return errJournalFdUnsupported
+}
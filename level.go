@@ -0,0 +1,267 @@
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levelCtl 临时等级的恢复定时器
+var levelCtl struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	revert  zapcore.Level // 到期后恢复的等级
+	expires time.Time
+}
+
+// GetLevel 当前的全局日志等级
+func GetLevel() zapcore.Level {
+	return appLevel.Level()
+}
+
+// SetLevel 修改全局日志等级, 取消未到期的临时等级
+func SetLevel(l zapcore.Level) {
+	levelCtl.mu.Lock()
+	from := appLevel.Level()
+	stopLevelRevert()
+	setLevel(l)
+	levelCtl.mu.Unlock()
+	logLevelChange("zlog level changed", from, l, 0)
+}
+
+// SetLevelFor 临时修改全局日志等级, d后恢复为修改前的等级; 临时等级未到期时再次修改, 到期后仍恢复为最初的等级
+func SetLevelFor(l zapcore.Level, d time.Duration) {
+	if d <= 0 {
+		SetLevel(l)
+		return
+	}
+	levelCtl.mu.Lock()
+	from := appLevel.Level()
+	if levelCtl.timer == nil {
+		levelCtl.revert = from
+	} else {
+		levelCtl.timer.Stop()
+	}
+	setLevel(l)
+	levelCtl.expires = time.Now().Add(d)
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		levelCtl.mu.Lock()
+		if levelCtl.timer != t {
+			levelCtl.mu.Unlock()
+			return
+		}
+		levelCtl.timer = nil
+		from, to := appLevel.Level(), levelCtl.revert
+		setLevel(to)
+		levelCtl.mu.Unlock()
+		logLevelChange("zlog level reverted", from, to, 0)
+	})
+	levelCtl.timer = t
+	levelCtl.mu.Unlock()
+	logLevelChange("zlog level changed", from, l, d)
+}
+
+func stopLevelRevert() {
+	if levelCtl.timer != nil {
+		levelCtl.timer.Stop()
+		levelCtl.timer = nil
+	}
+}
+
+// setLevel 只修改全局等级, 运行时的等级以 appLevel 为准, 不写回选项
+func setLevel(l zapcore.Level) {
+	appLevel.SetLevel(l)
+}
+
+// logLevelChange 用warn记录, 调高到warn以上时不输出
+func logLevelChange(msg string, from, to zapcore.Level, d time.Duration) {
+	fields := []zap.Field{zap.String("from", levelString(from)), zap.String("to", levelString(to))}
+	if d > 0 {
+		fields = append(fields, zap.Duration("duration", d))
+	}
+	Warn(msg, fields...)
+}
+
+// levelState 等级接口的响应
+type levelState struct {
+	Name    string            `json:"name,omitempty"` // 查询命名logger时为logger名, level为其生效的等级
+	Level   string            `json:"level"`
+	Names   map[string]string `json:"names,omitempty"`   // 按logger名设置的等级
+	VModule string            `json:"vmodule,omitempty"` // 按源文件提高等级的规则
+	Revert  string            `json:"revert,omitempty"`  // 临时等级到期后恢复的等级
+	Expires string            `json:"expires,omitempty"` // 临时等级的到期时间, RFC3339
+	Fields  []fieldLevelJSON  `json:"fields,omitempty"`  // 按字段值设置的等级
+}
+
+type fieldLevelJSON struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Level   string `json:"level"`
+	Expires string `json:"expires"`
+}
+
+// levelRequest 等级接口的请求, duration 为空时永久修改
+type levelRequest struct {
+	Name     string  `json:"name"`
+	Level    string  `json:"level"`
+	Duration string  `json:"duration"`
+	VModule  *string `json:"vmodule"` // 设置源文件规则, 空字符串清除
+	Field    string  `json:"field"`   // 按字段值设置等级的字段名, 与value同时设置
+	Value    string  `json:"value"`
+}
+
+func currentLevelState(name string) levelState {
+	if name != "" {
+		return levelState{Name: name, Level: levelString(namedLevel(loadNamedLevels(), name, appLevel.Level()))}
+	}
+	levelCtl.mu.Lock()
+	defer levelCtl.mu.Unlock()
+	s := levelState{Level: levelString(appLevel.Level()), VModule: GetVModule()}
+	if m := loadNamedLevels(); len(m) > 0 {
+		s.Names = make(map[string]string, len(m))
+		for k, v := range m {
+			s.Names[k] = levelString(v)
+		}
+	}
+	if levelCtl.timer != nil {
+		s.Revert = levelString(levelCtl.revert)
+		s.Expires = levelCtl.expires.Format(time.RFC3339)
+	}
+	for _, fl := range FieldLevels() {
+		s.Fields = append(s.Fields, fieldLevelJSON{Field: fl.Key, Value: fl.Value, Level: levelString(fl.Level), Expires: fl.Expires.Format(time.RFC3339)})
+	}
+	return s
+}
+
+// LevelHandler 查询和修改全局日志等级的http接口:
+//
+//	GET                                         返回 {"level":"info"}, 有临时等级时带 revert 和 expires
+//	PUT {"level":"debug","duration":"10m"}      debug 10分钟后恢复, 不带duration时永久修改
+//	PUT level=debug&duration=10m                表单或URL参数
+//	GET ?name=room.chat                         命名logger生效的等级, 未单独设置时继承上级或全局等级
+//	PUT name=room&level=debug                   设置命名logger的等级, 见 SetNamedLevel
+//	DELETE ?name=room                           删除命名logger的等级
+//	PUT vmodule=room/*.go=debug                 设置源文件规则, 见 SetVModule, 可与level同时设置
+//	PUT level=trace 或 level=v3                 低于debug的等级, 见 V
+//	PUT field=uid&value=10086&level=debug&duration=1h  带有该字段值的日志输出debug, 见 SetFieldLevel, 不带duration时30分钟
+//	DELETE ?field=uid&value=10086               删除按字段值设置的等级
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		name := query.Get("name")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodDelete:
+			if field := query.Get("field"); field != "" {
+				if query.Get("value") == "" {
+					writeLevelError(w, http.StatusBadRequest, fmt.Errorf("value is required with field"))
+					return
+				}
+				UnsetFieldLevel(field, query.Get("value"))
+				break
+			}
+			if name == "" {
+				writeLevelError(w, http.StatusBadRequest, fmt.Errorf("name or field is required"))
+				return
+			}
+			UnsetNamedLevel(name)
+		case http.MethodPut:
+			req, err := decodeLevelRequest(r)
+			if err != nil {
+				writeLevelError(w, http.StatusBadRequest, err)
+				return
+			}
+			if req.VModule != nil {
+				if err := SetVModule(*req.VModule); err != nil {
+					writeLevelError(w, http.StatusBadRequest, err)
+					return
+				}
+				if req.Level == "" {
+					break
+				}
+			}
+			l, err := parseLevel(req.Level)
+			if err != nil {
+				writeLevelError(w, http.StatusBadRequest, err)
+				return
+			}
+			var d time.Duration
+			if req.Duration != "" {
+				if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+					writeLevelError(w, http.StatusBadRequest, fmt.Errorf("duration %q invalid, want a positive duration like 10m", req.Duration))
+					return
+				}
+			}
+			if req.Field != "" {
+				if req.Name != "" {
+					writeLevelError(w, http.StatusBadRequest, fmt.Errorf("name and field cannot be set together"))
+					return
+				}
+				if req.Value == "" {
+					writeLevelError(w, http.StatusBadRequest, fmt.Errorf("value is required with field"))
+					return
+				}
+				SetFieldLevel(req.Field, req.Value, l, d)
+				break
+			}
+			name = req.Name
+			if name != "" {
+				if d > 0 {
+					writeLevelError(w, http.StatusBadRequest, fmt.Errorf("duration is not supported for named levels"))
+					return
+				}
+				SetNamedLevel(name, l)
+				break
+			}
+			SetLevelFor(l, d)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			writeLevelError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(currentLevelState(name))
+	})
+}
+
+// decodeLevelRequest json请求体, 否则读取表单和URL参数
+func decodeLevelRequest(r *http.Request) (levelRequest, error) {
+	var req levelRequest
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid json body: %w", err)
+		}
+	case "":
+		// 未带Content-Type的请求体按表单解析
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		fallthrough
+	default:
+		req.Name, req.Level, req.Duration = r.FormValue("name"), r.FormValue("level"), r.FormValue("duration")
+		req.Field, req.Value = r.FormValue("field"), r.FormValue("value")
+		if _, ok := r.Form["vmodule"]; ok {
+			vm := r.Form.Get("vmodule")
+			req.VModule = &vm
+		}
+	}
+	if req.Level == "" && req.VModule == nil {
+		return req, fmt.Errorf("level or vmodule is required")
+	}
+	return req, nil
+}
+
+func writeLevelError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -3,9 +3,11 @@ package logger
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/kyle-hy/zlog"
 	"github.com/v2pro/plz/gls"
+	"go.uber.org/zap/zapcore"
 )
 
 func logFormat(template string, fmtArgs []interface{}) string {
@@ -19,6 +21,97 @@ func logFormat(template string, fmtArgs []interface{}) string {
 	return msg
 }
 
+// Tracef logs a message at TraceLevel.
+func Tracef(template string, fmtArgs ...interface{}) {
+	if zlog.GetLogger() != nil {
+		if !zlog.GetLogger().Core().Enabled(zlog.TraceLevel) {
+			return
+		}
+		if ce := zlog.GetLogger().Check(zlog.TraceLevel, logFormat(template, fmtArgs)); ce != nil {
+			ce.Write(zlog.GoID(gls.GoID()))
+		}
+	} else {
+		fmt.Printf("log not init. "+template, fmtArgs)
+	}
+}
+
+// Verbose V(n) 的结果, 未开启时不格式化日志
+type Verbose struct {
+	level   zapcore.Level
+	enabled bool
+}
+
+// V glog风格的详细等级, 如 logger.V(3).Infof(...), 见 zlog.V
+func V(n int) Verbose {
+	v := zlog.V(n)
+	return Verbose{level: v.Level(), enabled: v.Enabled()}
+}
+
+// Enabled 是否可能输出
+func (v Verbose) Enabled() bool {
+	return v.enabled
+}
+
+// Infof logs a message at the verbosity level of V(n).
+func (v Verbose) Infof(template string, fmtArgs ...interface{}) {
+	if !v.enabled {
+		return
+	}
+	if ce := zlog.GetLogger().Check(v.level, logFormat(template, fmtArgs)); ce != nil {
+		ce.Write(zlog.GoID(gls.GoID()))
+	}
+}
+
+// Info logs a message at the verbosity level of V(n).
+func (v Verbose) Info(msg ...interface{}) {
+	if !v.enabled {
+		return
+	}
+	if ce := zlog.GetLogger().Check(v.level, logFormat("", msg)); ce != nil {
+		ce.Write(zlog.GoID(gls.GoID()))
+	}
+}
+
+// Limited 按调用点限频的日志, 见 zlog.Every
+type Limited struct {
+	l zlog.Limited
+}
+
+// Every 该调用点每d最多输出一条, 如 logger.Every(time.Second).Warnf(...)
+func Every(d time.Duration) Limited {
+	return Limited{zlog.Every(d)}
+}
+
+// FirstN 该调用点只输出前n条
+func FirstN(n int) Limited {
+	return Limited{zlog.FirstN(n)}
+}
+
+// EveryN 该调用点每n条输出一条
+func EveryN(n int) Limited {
+	return Limited{zlog.EveryN(n)}
+}
+
+// Debugf logs a message at DebugLevel if the call site is not rate limited.
+func (r Limited) Debugf(template string, fmtArgs ...interface{}) {
+	r.l.Log(zapcore.DebugLevel, logFormat(template, fmtArgs))
+}
+
+// Infof logs a message at InfoLevel if the call site is not rate limited.
+func (r Limited) Infof(template string, fmtArgs ...interface{}) {
+	r.l.Log(zapcore.InfoLevel, logFormat(template, fmtArgs))
+}
+
+// Warnf logs a message at WarnLevel if the call site is not rate limited.
+func (r Limited) Warnf(template string, fmtArgs ...interface{}) {
+	r.l.Log(zapcore.WarnLevel, logFormat(template, fmtArgs))
+}
+
+// Errorf logs a message at ErrorLevel if the call site is not rate limited.
+func (r Limited) Errorf(template string, fmtArgs ...interface{}) {
+	r.l.Log(zapcore.ErrorLevel, logFormat(template, fmtArgs))
+}
+
 // Debugf logs a message at DebugLevel.
 func Debugf(template string, fmtArgs ...interface{}) {
 	if zlog.GetLogger() != nil {
@@ -114,6 +207,21 @@ func Fatalf(template string, fmtArgs ...interface{}) {
 	}
 }
 
+// Trace logs a message at TraceLevel. The message includes any fields passed
+// at the log site, as well as any fields accumulated on the logger.
+func Trace(msg ...interface{}) {
+	if zlog.GetLogger() != nil {
+		if !zlog.GetLogger().Core().Enabled(zlog.TraceLevel) {
+			return
+		}
+		if ce := zlog.GetLogger().Check(zlog.TraceLevel, logFormat("", msg)); ce != nil {
+			ce.Write(zlog.GoID(gls.GoID()))
+		}
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
 // Debug logs a message at DebugLevel. The message includes any fields passed
 // at the log site, as well as any fields accumulated on the logger.
 func Debug(msg ...interface{}) {
@@ -0,0 +1,282 @@
+package zlog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// namedLevels 按logger名设置的等级, 写时复制, 读取无锁
+var namedLevels struct {
+	mu     sync.Mutex
+	levels atomic.Value // map[string]zapcore.Level
+}
+
+// SetNamedLevel 设置名为name的logger及其子logger的等级, 如 room 对 room.chat 生效, 子logger单独设置时以子logger为准
+func SetNamedLevel(name string, l zapcore.Level) {
+	updateNamedLevels(func(m map[string]zapcore.Level) { m[name] = l })
+}
+
+// UnsetNamedLevel 删除名为name的logger的等级, 之后继承上级logger或全局等级
+func UnsetNamedLevel(name string) {
+	updateNamedLevels(func(m map[string]zapcore.Level) { delete(m, name) })
+}
+
+// NamedLevels 按logger名设置的等级
+func NamedLevels() map[string]zapcore.Level {
+	m := loadNamedLevels()
+	cp := make(map[string]zapcore.Level, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+func loadNamedLevels() map[string]zapcore.Level {
+	m, _ := namedLevels.levels.Load().(map[string]zapcore.Level)
+	return m
+}
+
+func updateNamedLevels(fn func(map[string]zapcore.Level)) {
+	namedLevels.mu.Lock()
+	defer namedLevels.mu.Unlock()
+	old := loadNamedLevels()
+	m := make(map[string]zapcore.Level, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	fn(m)
+	namedLevels.levels.Store(m)
+}
+
+// namedLevel name的等级, 依次查找 a.b.c、a.b、a, 都未设置时为全局等级
+func namedLevel(m map[string]zapcore.Level, name string, global zapcore.Level) zapcore.Level {
+	for name != "" {
+		if l, ok := m[name]; ok {
+			return l
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return global
+}
+
+// namedLevelCore 按日志的logger名过滤等级, 包在所有输出的外层.
+// Enabled 取全局等级、所有logger等级、源文件规则和字段值等级中最低的, 由 Check 按logger名、调用点和字段精确判断
+type namedLevelCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+	ctx   []zapcore.Field // With 附加的可匹配字段值等级的字段
+}
+
+func newNamedLevelCore(core zapcore.Core, level zap.AtomicLevel) zapcore.Core {
+	return &namedLevelCore{Core: core, level: level}
+}
+
+func (c *namedLevelCore) Enabled(l zapcore.Level) bool {
+	if c.level.Enabled(l) || extraEnabled(l) {
+		return c.Core.Enabled(l)
+	}
+	for _, nl := range loadNamedLevels() {
+		if nl.Enabled(l) {
+			return c.Core.Enabled(l)
+		}
+	}
+	return false
+}
+
+func (c *namedLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	ctx := c.ctx[:len(c.ctx):len(c.ctx)]
+	for _, f := range fields {
+		if fieldMatchable(f) {
+			ctx = append(ctx, f)
+		}
+	}
+	return &namedLevelCore{Core: c.Core.With(fields), level: c.level, ctx: ctx}
+}
+
+func (c *namedLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	m := loadNamedLevels()
+	l := c.level.Level()
+	if len(m) > 0 && ent.LoggerName != "" {
+		l = namedLevel(m, ent.LoggerName, l)
+	}
+	if l.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	if vm := loadVModule(); vm.enabled(ent.Level) && vm.callerLevel().Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	if fl := loadFieldLevels(); fl.enabled(ent.Level) {
+		if fl.match(c.ctx, ent.Level) {
+			return c.Core.Check(ent, ce)
+		}
+		// 日志调用的字段在 Write 时才能拿到
+		return ce.AddCore(ent, fieldLevelCore{c})
+	}
+	return ce
+}
+
+// extraEnabled 源文件规则或字段值等级可能输出该等级
+func extraEnabled(l zapcore.Level) bool {
+	return loadVModule().enabled(l) || loadFieldLevels().enabled(l)
+}
+
+// Logger 命名的logger, 接口同包级函数, 日志的logger字段为名字, 可在 InitLog 之前创建, 重新加载配置后自动使用新的输出
+type Logger struct {
+	name  string
+	cache atomic.Value // namedCache
+}
+
+type namedCache struct {
+	base   *zap.Logger
+	logger *zap.Logger
+}
+
+// Named 创建名为name的logger, 等级通过 SetNamedLevel 单独设置
+func Named(name string) *Logger {
+	return &Logger{name: name}
+}
+
+// Named 创建子logger, 名字为 上级名字.name, 未单独设置等级时继承上级logger的等级
+func (l *Logger) Named(name string) *Logger {
+	return &Logger{name: l.name + "." + name}
+}
+
+// Name logger的名字
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// GetLogger 获取命名的zap logger, 未初始化时返回nil
+func (l *Logger) GetLogger() *zap.Logger {
+	base := GetLogger()
+	if base == nil {
+		return nil
+	}
+	if c, ok := l.cache.Load().(namedCache); ok && c.base == base {
+		return c.logger
+	}
+	logger := base.Named(l.name)
+	l.cache.Store(namedCache{base: base, logger: logger})
+	return logger
+}
+
+// Enabled 该logger是否输出level等级的日志
+func (l *Logger) Enabled(level zapcore.Level) bool {
+	return namedLevel(loadNamedLevels(), l.name, appLevel.Level()).Enabled(level)
+}
+
+// V 同 zlog.V, 按该logger的等级判断
+func (l *Logger) V(n int) Verbose {
+	level := VLevel(n)
+	logger := l.GetLogger()
+	if logger == nil || !(l.Enabled(level) || extraEnabled(level)) {
+		return Verbose{level: level}
+	}
+	return Verbose{logger: logger, level: level}
+}
+
+// Trace logs a message at TraceLevel.
+func (l *Logger) Trace(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		if ce := logger.Check(TraceLevel, msg); ce != nil {
+			ce.Write(addGoID(fields)...)
+		}
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// Debug logs a message at DebugLevel.
+func (l *Logger) Debug(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Debug(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// Info logs a message at InfoLevel.
+func (l *Logger) Info(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Info(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// Warn logs a message at WarnLevel.
+func (l *Logger) Warn(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Warn(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// Error logs a message at ErrorLevel.
+func (l *Logger) Error(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Error(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// PanicAsync logs a message at ErrorLevel and flush to file, then panics.
+func (l *Logger) PanicAsync(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Error("panic:"+msg, addGoID(fields)...)
+		logger.Sync()
+		panic(msg)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// FatalAsync logs a message at FatalLevel and flush to file, then calls os.Exit(1).
+func (l *Logger) FatalAsync(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Error("fatal:"+msg, addGoID(fields)...)
+		logger.Sync()
+		os.Exit(1)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// DPanic logs a message at DPanicLevel.
+func (l *Logger) DPanic(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.DPanic(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// Panic logs a message at PanicLevel, then panics.
+func (l *Logger) Panic(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Panic(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
+
+// Fatal logs a message at FatalLevel, then calls os.Exit(1).
+func (l *Logger) Fatal(msg string, fields ...zapcore.Field) {
+	if logger := l.GetLogger(); logger != nil {
+		logger.Fatal(msg, addGoID(fields)...)
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
+}
@@ -0,0 +1,97 @@
+package zlog
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	dialTimeout  = 3 * time.Second
+	writeTimeout = 5 * time.Second
+	minBackoff   = 100 * time.Millisecond
+	maxBackoff   = 30 * time.Second
+)
+
+var errNotConnected = errors.New("zlog: not connected, waiting to reconnect")
+
+// netConn 网络输出的连接, 断开后按指数退避重连, 等待重连期间不阻塞异步写协程
+type netConn struct {
+	networks []string // 依次尝试的网络类型, 如 unixgram、unix
+	addr     string
+	check    func(addr string) error // 连接前检查地址, 如socket的属主
+	conn     net.Conn
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+func newNetConn(addr string, networks ...string) *netConn {
+	return &netConn{networks: networks, addr: addr}
+}
+
+// get 获取连接, 未连接且到了重连时间则重新连接
+func (c *netConn) get() (net.Conn, error) {
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	if time.Now().Before(c.retryAt) {
+		return nil, errNotConnected
+	}
+
+	var err error
+	if c.check != nil {
+		err = c.check(c.addr)
+	}
+	if err == nil {
+		for _, network := range c.networks {
+			var conn net.Conn
+			if conn, err = net.DialTimeout(network, c.addr, dialTimeout); err == nil {
+				c.conn, c.backoff = conn, 0
+				return conn, nil
+			}
+		}
+	}
+	c.backoff = nextBackoff(c.backoff)
+	c.retryAt = time.Now().Add(c.backoff)
+	return nil, err
+}
+
+// stream 当前连接是否为流式连接(tcp、unix), 否则为数据报
+func (c *netConn) stream() bool {
+	if c.conn == nil {
+		return false
+	}
+	network := c.conn.LocalAddr().Network()
+	return network == "tcp" || network == "unix"
+}
+
+// reset 写失败后断开连接, 下次get时重连
+func (c *netConn) reset() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// Close 关闭连接
+func (c *netConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// nextBackoff 指数退避, 加入随机抖动避免大量进程同时重连
+func nextBackoff(cur time.Duration) time.Duration {
+	next := cur * 2
+	if next < minBackoff {
+		next = minBackoff
+	}
+	if next > maxBackoff {
+		next = maxBackoff
+	}
+	return next/2 + time.Duration(rand.Int63n(int64(next/2)+1))
+}
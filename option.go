@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,14 +16,32 @@ const (
 
 // Options 属性
 type Options struct {
-	level     zapcore.Level          // 测试环境日志级别为debug
-	logPath   string                 // 日志路径
-	withGID   bool                   // 打印协程id
-	stdout    bool                   // 日志同时打印到标准输出
-	overflow  bool                   // 日志缓存管道溢出则丢弃日志
-	rotate    bool                   // 是否使用lumberjack滚动日志
-	bufioSize int                    // 写文件io的缓存大小
-	fields    map[string]interface{} // 日志默认附加的字段
+	level       zapcore.Level          // 测试环境日志级别为debug
+	logPath     string                 // 日志路径
+	withGID     bool                   // 打印协程id
+	stdout      bool                   // 日志同时打印到标准输出
+	overflow    bool                   // 日志缓存管道溢出则丢弃日志
+	rotate      bool                   // 是否使用lumberjack滚动日志
+	bufioSize   int                    // 写文件io的缓存大小
+	fields      map[string]interface{} // 日志默认附加的字段
+	audit       bool                   // 是否开启同步落盘的审计日志
+	auditPath   string                 // 审计日志路径
+	hashChain   bool                   // 每行日志追加序号和防篡改哈希链
+	encryptKey  []byte                 // 日志文件加密的AES密钥
+	compress    bool                   // 当前日志文件流式gzip压缩
+	encoding    string                 // 日志编码, json 或 zbin
+	outputPaths []string               // 额外的输出, zap的sink URL, 如 syslog+tcp://host:514
+	outputs     []Output               // 输出列表, 设置后替代默认的文件、Stdout 和 OutputPaths
+	container   bool                   // 容器模式, 只异步输出到标准输出, 不写文件
+	k8sKeys     bool                   // 使用 severity、timestamp、message 等字段名
+	vmodule     string                 // 按源文件提高等级的规则, 见 SetVModule
+
+	sampleTick       time.Duration // 按消息采样的间隔
+	sampleFirst      int           // 每个间隔内同一消息先输出的条数, 0为不采样
+	sampleThereafter int           // 之后每多少条输出一条
+	hashSampleKey    string        // 按该字段值一致性哈希采样
+	hashSampleRate   float64       // 一致性哈希采样输出的比例
+	hashSampleErrors bool          // error以上的日志也按字段值采样
 }
 
 var defaultOptions = Options{
@@ -31,6 +50,7 @@ var defaultOptions = Options{
 	overflow:  false,
 	rotate:    true,
 	bufioSize: 1024 * 8,
+	encoding:  "json",
 }
 
 // 由于日志文件配套工具有相关限制，故不提供灵活的文件路径
@@ -84,6 +104,34 @@ func Rotate(rotate bool) Option {
 	}
 }
 
+// HashChain 每行日志追加序号seq和链接上一行的哈希hash, 滚动后哈希链跨文件延续, 使用 zlog verify 校验
+func HashChain(hashChain bool) Option {
+	return func(o *Options) {
+		o.hashChain = hashChain
+	}
+}
+
+// Encrypt 日志文件使用AES-GCM分块加密落盘, key为16/24/32字节的AES密钥, 使用 zlog decrypt 解密
+func Encrypt(key []byte) Option {
+	return func(o *Options) {
+		o.encryptKey = key
+	}
+}
+
+// Compress 当前日志文件流式gzip压缩, 每次Flush产生刷新点, 崩溃后已写入的部分仍可读取
+func Compress(compress bool) Option {
+	return func(o *Options) {
+		o.compress = compress
+	}
+}
+
+// Encoding 日志编码, 默认json, BinaryEncoding 为紧凑的二进制编码, 使用 zlog decode 转换为json
+func Encoding(encoding string) Option {
+	return func(o *Options) {
+		o.encoding = encoding
+	}
+}
+
 // WithFields 所有日志都附带的字段
 func WithFields(fields map[string]interface{}) Option {
 	return func(o *Options) {
@@ -91,6 +139,21 @@ func WithFields(fields map[string]interface{}) Option {
 	}
 }
 
+// WithAudit 开启审计日志, 通过 zlog.Audit 同步写入独立文件并fsync
+func WithAudit(audit bool) Option {
+	return func(o *Options) {
+		o.audit = audit
+	}
+}
+
+// AuditPath 审计日志文件路径, 设置后同时开启审计日志
+func AuditPath(auditPath string) Option {
+	return func(o *Options) {
+		o.audit = true
+		o.auditPath = auditPath
+	}
+}
+
 // Stdout 日志打印到标准输出
 func Stdout(stdout bool) Option {
 	return func(o *Options) {
@@ -98,6 +161,68 @@ func Stdout(stdout bool) Option {
 	}
 }
 
+// OutputPaths 额外的日志输出, 为注册到zap的sink URL, 如 stderr、syslog+tcp://host:514
+func OutputPaths(paths ...string) Option {
+	return func(o *Options) {
+		o.outputPaths = paths
+	}
+}
+
+// Container 容器模式: 不写文件, 日志经异步管道输出到标准输出, 管道满后丢弃并计数(见 Stats), 不阻塞业务协程.
+// Stdout 选项不再生效, OutputPaths 仍然追加
+func Container(container bool) Option {
+	return func(o *Options) {
+		o.container = container
+	}
+}
+
+// K8sKeys 使用k8s日志采集友好的字段名: severity(大写等级)、timestamp(RFC3339)、message
+func K8sKeys(k8sKeys bool) Option {
+	return func(o *Options) {
+		o.k8sKeys = k8sKeys
+	}
+}
+
+// Outputs 设置输出列表, 每个输出有独立的目的地、等级、编码和异步模式,
+// 设置后替代默认的异步文件输出、Stdout 和 OutputPaths, 需要文件输出时加入 Output{URL: "AsyncLog://127.0.0.1"}
+func Outputs(outputs ...Output) Option {
+	return func(o *Options) {
+		o.outputs = outputs
+	}
+}
+
+// VModule 按源文件提高等级的规则, 如 "room/*.go=debug,gateway/conn.go=debug", 见 SetVModule
+func VModule(spec string) Option {
+	return func(o *Options) {
+		o.vmodule = spec
+	}
+}
+
+// Sampling 按消息采样, 每tick内同一等级同一消息的前first条输出, 之后每thereafter条输出一条, 丢弃的条数见 Stats
+func Sampling(tick time.Duration, first, thereafter int) Option {
+	return func(o *Options) {
+		o.sampleTick = tick
+		o.sampleFirst = first
+		o.sampleThereafter = thereafter
+	}
+}
+
+// HashSampling 按字段key的值一致性哈希采样, 如 HashSampling("uid", 0.1) 只输出约10%用户的日志,
+// 同一用户要么全部输出要么全部不输出; 不带该字段、error以上(见 HashSampleErrors)和 SetFieldLevel 设置了该值的日志不采样
+func HashSampling(key string, rate float64) Option {
+	return func(o *Options) {
+		o.hashSampleKey = key
+		o.hashSampleRate = rate
+	}
+}
+
+// HashSampleErrors 为true时error以上的日志也按字段值采样, 默认不采样
+func HashSampleErrors(sample bool) Option {
+	return func(o *Options) {
+		o.hashSampleErrors = sample
+	}
+}
+
 // DebugLevel debug日志等级
 func DebugLevel() Option {
 	return func(o *Options) {
@@ -105,6 +230,13 @@ func DebugLevel() Option {
 	}
 }
 
+// Verbosity 输出 V(n) 及以上的日志, 如 Verbosity(2) 为trace等级, 见 VLevel
+func Verbosity(n int) Option {
+	return func(o *Options) {
+		o.level = VLevel(n)
+	}
+}
+
 // InfoLevel info日志等级
 func InfoLevel() Option {
 	return func(o *Options) {
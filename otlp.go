@@ -0,0 +1,247 @@
+package zlog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	otlpLogsPath  = "/v1/logs"
+	otlpScopeName = "github.com/kyle-hy/zlog"
+)
+
+func init() {
+	RegisterBatchFormat("otlp", newOTLPFormat)
+}
+
+// otlpSeverity zap日志等级对应的OTLP SeverityNumber
+func otlpSeverity(l zapcore.Level) int {
+	switch l {
+	case zapcore.DebugLevel:
+		return 5 // DEBUG
+	case zapcore.InfoLevel:
+		return 9 // INFO
+	case zapcore.WarnLevel:
+		return 13 // WARN
+	case zapcore.ErrorLevel:
+		return 17 // ERROR
+	case zapcore.DPanicLevel:
+		return 19 // ERROR3
+	case zapcore.PanicLevel:
+		return 21 // FATAL
+	case zapcore.FatalLevel:
+		return 24 // FATAL4
+	}
+	if l < zapcore.DebugLevel {
+		return 1 // TRACE
+	}
+	return 17
+}
+
+// OTLP/HTTP JSON 编码用到的结构, 字段名同 opentelemetry-proto 的json映射
+type (
+	otlpAnyValue struct {
+		StringValue *string          `json:"stringValue,omitempty"`
+		BoolValue   *bool            `json:"boolValue,omitempty"`
+		IntValue    *string          `json:"intValue,omitempty"` // int64按proto3 json映射编码为字符串
+		DoubleValue *float64         `json:"doubleValue,omitempty"`
+		ArrayValue  *otlpArrayValue  `json:"arrayValue,omitempty"`
+		KvlistValue *otlpKeyValueSet `json:"kvlistValue,omitempty"`
+	}
+	otlpArrayValue struct {
+		Values []otlpAnyValue `json:"values"`
+	}
+	otlpKeyValueSet struct {
+		Values []otlpKeyValue `json:"values"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpLogRecord struct {
+		TimeUnixNano         string         `json:"timeUnixNano"`
+		ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+		SeverityNumber       int            `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		Body                 otlpAnyValue   `json:"body"`
+		Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+		TraceID              string         `json:"traceId,omitempty"`
+		SpanID               string         `json:"spanId,omitempty"`
+	}
+	otlpScopeLogs struct {
+		Scope      map[string]string `json:"scope"`
+		LogRecords []otlpLogRecord   `json:"logRecords"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpResourceLogs struct {
+		Resource  otlpResource    `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+)
+
+func otlpString(s string) otlpAnyValue {
+	return otlpAnyValue{StringValue: &s}
+}
+
+// otlpValue json解码得到的值转换为AnyValue
+func otlpValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case nil:
+		return otlpAnyValue{}
+	case string:
+		return otlpString(v)
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			s := v.String()
+			return otlpAnyValue{IntValue: &s}
+		}
+		f, _ := v.Float64()
+		return otlpAnyValue{DoubleValue: &f}
+	case []interface{}:
+		a := &otlpArrayValue{Values: make([]otlpAnyValue, 0, len(v))}
+		for _, e := range v {
+			a.Values = append(a.Values, otlpValue(e))
+		}
+		return otlpAnyValue{ArrayValue: a}
+	case map[string]interface{}:
+		return otlpAnyValue{KvlistValue: &otlpKeyValueSet{Values: otlpAttributes(v)}}
+	}
+	return otlpAnyValue{}
+}
+
+// otlpAttributes 按key排序转换为属性列表
+func otlpAttributes(m map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: otlpValue(m[k])})
+	}
+	return attrs
+}
+
+// otlpID 校验十六进制的trace/span id
+func otlpID(v interface{}, size int) (string, bool) {
+	s, ok := v.(string)
+	if !ok || len(s) != size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+	return strings.ToLower(s), true
+}
+
+// otlpFormat OTLP/HTTP JSON 请求体, 一个批次为一个ResourceLogs
+// 资源属性 service.name 默认为进程名, 通过URL参数 service=name 和 resource.key=value 设置
+type otlpFormat struct {
+	resource otlpResource
+}
+
+func newOTLPFormat(q url.Values) (BatchFormat, error) {
+	resource := map[string]interface{}{
+		"service.name": processName(),
+		"process.pid":  json.Number(strconv.Itoa(os.Getpid())),
+	}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		resource["host.name"] = h
+	}
+	if s := q.Get("service"); s != "" {
+		resource["service.name"] = s
+	}
+	for k, v := range q {
+		if strings.HasPrefix(k, "resource.") && len(v) > 0 {
+			resource[strings.TrimPrefix(k, "resource.")] = v[0]
+		}
+	}
+	return &otlpFormat{resource: otlpResource{Attributes: otlpAttributes(resource)}}, nil
+}
+
+func (f *otlpFormat) ContentType() string { return "application/json" }
+
+func (f *otlpFormat) Encode(w io.Writer, entries []BatchEntry) error {
+	records := make([]otlpLogRecord, 0, len(entries))
+	for _, e := range entries {
+		records = append(records, otlpRecord(e))
+	}
+	rl := otlpResourceLogs{
+		Resource:  f.resource,
+		ScopeLogs: []otlpScopeLogs{{Scope: map[string]string{"name": otlpScopeName}, LogRecords: records}},
+	}
+	return json.NewEncoder(w).Encode(map[string][]otlpResourceLogs{"resourceLogs": {rl}})
+}
+
+// otlpRecord 把一条json日志转换为LogRecord, 非json日志整行作为body
+func otlpRecord(e BatchEntry) otlpLogRecord {
+	r := otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(e.Time.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		SeverityNumber:       otlpSeverity(zapcore.InfoLevel),
+		SeverityText:         "INFO",
+	}
+	fields, err := decodeLine(e.Line)
+	if err != nil {
+		r.Body = otlpString(string(e.Line))
+		return r
+	}
+
+	cfg := lineEncoderConfig()
+	attrs := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		s, _ := v.(string)
+		switch k {
+		case cfg.MessageKey:
+			r.Body = otlpValue(v)
+		case cfg.LevelKey:
+			if l, ok := textLevel(s); ok {
+				r.SeverityNumber = otlpSeverity(l)
+				r.SeverityText = capitalLevelString(l)
+			}
+		case cfg.TimeKey:
+			if t, err := parseLogTime(s); err == nil {
+				r.TimeUnixNano = strconv.FormatInt(t.UnixNano(), 10)
+			}
+		case cfg.CallerKey:
+			file, line, fn := splitCaller(s)
+			attrs["code.filepath"] = file
+			attrs["code.lineno"] = json.Number(strconv.Itoa(line))
+			attrs["code.function"] = fn
+		case cfg.StacktraceKey:
+			attrs["exception.stacktrace"] = v
+		case cfg.NameKey:
+			attrs["logger.name"] = v
+		case logCommonKeyTraceID:
+			if id, ok := otlpID(v, 16); ok {
+				r.TraceID = id
+			} else {
+				attrs[k] = v
+			}
+		case logCommonKeySpanID:
+			if id, ok := otlpID(v, 8); ok {
+				r.SpanID = id
+			} else {
+				attrs[k] = v
+			}
+		default:
+			attrs[k] = v
+		}
+	}
+	r.Attributes = otlpAttributes(attrs)
+	return r
+}
@@ -0,0 +1,141 @@
+package zlog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// otlpRequest 收到的OTLP/HTTP JSON请求体
+type otlpRequest struct {
+	ResourceLogs []struct {
+		Resource  otlpResource `json:"resource"`
+		ScopeLogs []struct {
+			Scope      map[string]string `json:"scope"`
+			LogRecords []otlpLogRecord   `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+func TestOTLPExport(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpLogsPath || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("request %s %s %v", r.Method, r.URL, r.Header)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(zr).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		requests <- req
+	}))
+	defer srv.Close()
+
+	endpoint, _ := url.Parse(srv.URL + otlpLogsPath + "?service=room&resource.env=test&retries=0")
+	format, err := newOTLPFormat(endpoint.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := newHTTPShipper(endpoint, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levels := []struct {
+		level  zapcore.Level
+		number int
+		text   string
+	}{
+		{TraceLevel, 1, "TRACE"},
+		{zapcore.DebugLevel, 5, "DEBUG"},
+		{zapcore.InfoLevel, 9, "INFO"},
+		{zapcore.WarnLevel, 13, "WARN"},
+		{zapcore.ErrorLevel, 17, "ERROR"},
+		{zapcore.DPanicLevel, 19, "DPANIC"},
+		{zapcore.PanicLevel, 21, "PANIC"},
+		{zapcore.FatalLevel, 24, "FATAL"},
+	}
+	enc := zapcore.NewJSONEncoder(lineEncoderConfig())
+	when := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	traceID, spanID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	for _, l := range levels {
+		ent := zapcore.Entry{
+			Level:   l.level,
+			Time:    when,
+			Message: "enter room",
+			Caller:  zapcore.NewEntryCaller(0, "/src/room/room.go", 42, true),
+		}
+		buf, err := enc.EncodeEntry(ent, []zapcore.Field{UID(10086), TraceID(traceID), SpanID(spanID)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write(append([]byte(nil), buf.Bytes()...))
+		buf.Free()
+	}
+	h.Close()
+
+	var req otlpRequest
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request")
+	}
+	if len(req.ResourceLogs) != 1 || len(req.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("unexpected payload %+v", req)
+	}
+	resource := attrMap(req.ResourceLogs[0].Resource.Attributes)
+	if resource["service.name"] != "room" || resource["env"] != "test" {
+		t.Errorf("resource = %v", resource)
+	}
+	scope := req.ResourceLogs[0].ScopeLogs[0]
+	if scope.Scope["name"] != otlpScopeName {
+		t.Errorf("scope = %v", scope.Scope)
+	}
+	if len(scope.LogRecords) != len(levels) {
+		t.Fatalf("%d records, want %d", len(scope.LogRecords), len(levels))
+	}
+	for i, r := range scope.LogRecords {
+		l := levels[i]
+		if r.SeverityNumber != l.number || r.SeverityText != l.text {
+			t.Errorf("%v: severity = %d %s, want %d %s", l.level, r.SeverityNumber, r.SeverityText, l.number, l.text)
+		}
+		if r.TimeUnixNano != "1714979289123456789" {
+			t.Errorf("%v: timeUnixNano = %s", l.level, r.TimeUnixNano)
+		}
+		if r.Body.StringValue == nil || *r.Body.StringValue != "enter room" {
+			t.Errorf("%v: body = %+v", l.level, r.Body)
+		}
+		if r.TraceID != traceID || r.SpanID != spanID {
+			t.Errorf("%v: trace = %s %s", l.level, r.TraceID, r.SpanID)
+		}
+		attrs := attrMap(r.Attributes)
+		if attrs[logCommonKeyUID] != "10086" || attrs["code.filepath"] != "room/room.go" || attrs["code.lineno"] != "42" {
+			t.Errorf("%v: attributes = %v", l.level, attrs)
+		}
+	}
+}
+
+// attrMap 属性列表转换为map, 值为字符串或整数的字符串形式
+func attrMap(attrs []otlpKeyValue) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		switch {
+		case kv.Value.StringValue != nil:
+			m[kv.Key] = *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			m[kv.Key] = *kv.Value.IntValue
+		}
+	}
+	return m
+}
@@ -0,0 +1,282 @@
+package zlog
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultFileOutput      = "AsyncLog://127.0.0.1"
+	defaultContainerOutput = "async+stdout://?overflow=drop"
+)
+
+// Output 一个日志输出, 每个输出有独立的等级和编码
+type Output struct {
+	URL      string `json:"url" yaml:"url"`                               // zap sink URL, 如 AsyncLog://127.0.0.1、stdout、syslog+tcp://host:514、/var/log/x.log
+	Level    string `json:"level,omitempty" yaml:"level,omitempty"`       // 该输出的最低等级, 如 warn, 为空时只受全局等级限制
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"` // json、console、color、gelf、zbin, 为空时同 Encoding 选项
+	Async    bool   `json:"async,omitempty" yaml:"async,omitempty"`       // 在同步输出前加异步管道, 本库的sink本身是异步的, 忽略该设置
+}
+
+// defaultOutputs 未设置 Outputs 时由 Container、Stdout、OutputPaths 选项得到输出列表
+func defaultOutputs(opt *Options) []Output {
+	outputs := []Output{{URL: defaultFileOutput}}
+	if opt.container {
+		outputs = []Output{{URL: defaultContainerOutput}}
+	} else if opt.stdout {
+		outputs = append(outputs, Output{URL: "stdout"})
+	}
+	for _, p := range opt.outputPaths {
+		outputs = append(outputs, Output{URL: p})
+	}
+	return outputs
+}
+
+// jsonLineSchemes 按json日志行解析等级、时间等字段的输出, 只能使用json编码, gelf输出也可以使用gelf编码
+var jsonLineSchemes = map[string]bool{
+	"syslog+udp":  true,
+	"syslog+tcp":  true,
+	"syslog+unix": true,
+	"gelf+udp":    true,
+	"gelf+tcp":    true,
+	"journald":    true,
+	"otlp+http":   true,
+	"otlp+https":  true,
+	"fluent+tcp":  true,
+	"fluent+unix": true,
+}
+
+// recordSchemes 把编码后的日志逐条转发给其他进程的输出, 接收方按自己的文件写入链写入, 不支持二进制编码
+var recordSchemes = map[string]bool{
+	"zlogd": true,
+	"shm":   true,
+}
+
+// outputEncoding 输出的编码, 为空时同 Encoding 选项. 输出不支持该编码时, 未设置编码则使用json, 否则返回错误
+func outputEncoding(out Output, global string) (string, error) {
+	encoding := out.Encoding
+	if encoding == "" {
+		encoding = global
+	}
+	u, err := url.Parse(out.URL)
+	if err != nil {
+		return encoding, nil
+	}
+	switch {
+	case jsonLineSchemes[u.Scheme]:
+		if encoding == "json" || encoding == GELFEncoding && strings.HasPrefix(u.Scheme, "gelf+") {
+			return encoding, nil
+		}
+	case recordSchemes[u.Scheme]:
+		if encoding != BinaryEncoding {
+			return encoding, nil
+		}
+	default:
+		return encoding, nil
+	}
+	if out.Encoding == "" {
+		return "json", nil
+	}
+	return "", fmt.Errorf("zlog: output %s does not support encoding %q", out.URL, out.Encoding)
+}
+
+// newOutputEncoder 按名字创建编码器
+func newOutputEncoder(encoding string, k8sKeys bool) (zapcore.Encoder, error) {
+	cfg := newEncoderConfig(k8sKeys)
+	switch encoding {
+	case "json":
+		return zapcore.NewJSONEncoder(cfg), nil
+	case "console":
+		return zapcore.NewConsoleEncoder(cfg), nil
+	case "color":
+		cfg.EncodeLevel = capitalColorLevelEncoder
+		return zapcore.NewConsoleEncoder(cfg), nil
+	case GELFEncoding:
+		return newGELFEncoder(), nil
+	case BinaryEncoding:
+		return newBinaryEncoder(), nil
+	}
+	return nil, fmt.Errorf("zlog: unknown output encoding %q", encoding)
+}
+
+// outputURL 需要异步的同步输出加 async+ 前缀
+func outputURL(out Output) (string, error) {
+	if !out.Async {
+		return out.URL, nil
+	}
+	switch out.URL {
+	case "stdout", "stderr":
+		return asyncSchemePrefix + out.URL + "://", nil
+	}
+	u, err := url.Parse(out.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" {
+		// 普通文件路径
+		path, err := filepath.Abs(out.URL)
+		if err != nil {
+			return "", err
+		}
+		return asyncSchemePrefix + "file://" + filepath.ToSlash(path), nil
+	}
+	if _, ok := sinkFactories[u.Scheme]; ok || strings.HasPrefix(u.Scheme, asyncSchemePrefix) {
+		return out.URL, nil
+	}
+	return asyncSchemePrefix + out.URL, nil
+}
+
+// newOutputCore 创建一个输出的core, 只判断输出的等级
+func newOutputCore(out Output, opt *Options) (zapcore.Core, func(), error) {
+	encoding, err := outputEncoding(out, opt.encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.HasPrefix(out.URL, "AsyncLog:") && encoding != opt.encoding {
+		// 文件写入链按 Encoding 选项处理二进制字典和哈希链
+		return nil, nil, fmt.Errorf("zlog: output %s encoding must match Encoding option %q", out.URL, opt.encoding)
+	}
+	var enc zapcore.Encoder
+	if u, _ := url.Parse(out.URL); u != nil && jsonLineSchemes[u.Scheme] && encoding == "json" {
+		enc = zapcore.NewJSONEncoder(lineEncoderConfig())
+	} else if enc, err = newOutputEncoder(encoding, opt.k8sKeys); err != nil {
+		return nil, nil, err
+	}
+
+	minLevel := zapcore.Level(math.MinInt8)
+	if out.Level != "" {
+		l, err := parseLevel(out.Level)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zlog: output %s: %w", out.URL, err)
+		}
+		minLevel = l
+	}
+
+	path, err := outputURL(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	ws, closeSink, err := zap.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 全局等级和logger名的等级由外层的 namedLevelCore 判断
+	return zapcore.NewCore(enc, ws, minLevel), closeSink, nil
+}
+
+// outputTee 合并各输出的core, 同 zapcore.NewTee, 另外实现 enabledWriter 直接写入各开启的输出
+type outputTee []zapcore.Core
+
+func (t outputTee) Enabled(l zapcore.Level) bool {
+	for _, c := range t {
+		if c.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t outputTee) With(fields []zapcore.Field) zapcore.Core {
+	clone := make(outputTee, len(t))
+	for i, c := range t {
+		clone[i] = c.With(fields)
+	}
+	return clone
+}
+
+func (t outputTee) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	for _, c := range t {
+		ce = c.Check(ent, ce)
+	}
+	return ce
+}
+
+func (t outputTee) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var err error
+	for _, c := range t {
+		err = multierr.Append(err, c.Write(ent, fields))
+	}
+	return err
+}
+
+func (t outputTee) writeEnabled(ent zapcore.Entry, fields []zapcore.Field) error {
+	var err error
+	for _, c := range t {
+		if c.Enabled(ent.Level) {
+			err = multierr.Append(err, c.Write(ent, fields))
+		}
+	}
+	return err
+}
+
+func (t outputTee) Sync() error {
+	var err error
+	for _, c := range t {
+		err = multierr.Append(err, c.Sync())
+	}
+	return err
+}
+
+// newTeeLogger 每个输出一个core, 合并后按全局等级和logger名的等级过滤, 其余选项同zap.Config默认的生产配置
+func newTeeLogger(opt *Options, level zap.AtomicLevel) (*zap.Logger, error) {
+	outputs := opt.outputs
+	if len(outputs) == 0 {
+		outputs = defaultOutputs(opt)
+	}
+
+	var (
+		cores  []zapcore.Core
+		closes []func()
+	)
+	closeAll := func() {
+		for _, c := range closes {
+			c()
+		}
+	}
+	for _, out := range outputs {
+		core, closeSink, err := newOutputCore(out, opt)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		cores = append(cores, core)
+		closes = append(closes, closeSink)
+	}
+
+	errSink, _, err := zap.Open("stderr")
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	zopts := []zap.Option{
+		zap.ErrorOutput(errSink),
+		zap.AddCaller(),
+		zap.AddStacktrace(zap.ErrorLevel),
+		zap.AddCallerSkip(1),
+	}
+	core := newNamedLevelCore(newHashSampleCore(newSamplerCore(outputTee(cores), opt), opt), level)
+	if len(opt.fields) > 0 {
+		keys := make([]string, 0, len(opt.fields))
+		for k := range opt.fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields := make([]zap.Field, 0, len(keys))
+		for _, k := range keys {
+			fields = append(fields, zap.Any(k, opt.fields[k]))
+		}
+		// 固定字段附加在 drainCore 内层, 替换logger后转给新logger时不重复
+		core = core.With(fields)
+	}
+	// 输出在logger替换或关闭后由 retireLogger 关闭
+	return zap.New(newDrainCore(core, closeAll), zopts...), nil
+}
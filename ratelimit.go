@@ -0,0 +1,150 @@
+package zlog
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// callSiteLimiter 一个调用点的限频状态
+type callSiteLimiter struct {
+	mu         sync.Mutex
+	every      time.Duration // Every 的间隔
+	n          uint64        // EveryN 的n, FirstN 的n
+	first      bool          // FirstN
+	count      uint64        // 调用次数
+	last       time.Time     // 上次输出的时间
+	suppressed uint64        // 上次输出后被抑制的次数
+}
+
+// allow 本次是否输出, 输出时返回之前被抑制的次数
+func (l *callSiteLimiter) allow() (uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	var ok bool
+	switch {
+	case l.every > 0:
+		now := time.Now()
+		if ok = l.last.IsZero() || now.Sub(l.last) >= l.every; ok {
+			l.last = now
+		}
+	case l.first:
+		ok = l.count <= l.n
+	default:
+		ok = l.n <= 1 || l.count%l.n == 1
+	}
+	if !ok {
+		l.suppressed++
+		return 0, false
+	}
+	n := l.suppressed
+	l.suppressed = 0
+	return n, true
+}
+
+var (
+	callSiteLimiters sync.Map // pc -> *callSiteLimiter
+	callSiteWrappers sync.Map // pc -> bool, 是否为本库的封装函数
+)
+
+// Limited 按调用点限频的日志, 输出的日志带有 suppressed 字段, 为上次输出后被抑制的次数
+type Limited struct {
+	lim *callSiteLimiter
+}
+
+// Every 该调用点每d最多输出一条, 如 zlog.Every(time.Second).Warn(...)
+func Every(d time.Duration) Limited {
+	return Limited{lim: loadLimiter(callSite(), &callSiteLimiter{every: d})}
+}
+
+// FirstN 该调用点只输出前n条
+func FirstN(n int) Limited {
+	return Limited{lim: loadLimiter(callSite(), &callSiteLimiter{n: uint64(n), first: true})}
+}
+
+// EveryN 该调用点每n条输出一条, 第1、n+1、2n+1...条输出
+func EveryN(n int) Limited {
+	return Limited{lim: loadLimiter(callSite(), &callSiteLimiter{n: uint64(n)})}
+}
+
+// loadLimiter 调用点第一次调用时的参数生效
+func loadLimiter(pc uintptr, lim *callSiteLimiter) *callSiteLimiter {
+	if v, ok := callSiteLimiters.Load(pc); ok {
+		return v.(*callSiteLimiter)
+	}
+	v, _ := callSiteLimiters.LoadOrStore(pc, lim)
+	return v.(*callSiteLimiter)
+}
+
+// callSite 调用 Every 等函数的位置, 跳过本库和 logger 包的封装函数, 与 caller 字段的调用点相同
+func callSite() uintptr {
+	var pcs [8]uintptr
+	n := runtime.Callers(3, pcs[:]) // 跳过 runtime.Callers、callSite、Every
+	for _, pc := range pcs[:n] {
+		wrapper, ok := callSiteWrappers.Load(pc)
+		if !ok {
+			_, ok := callerFrame(pc)
+			wrapper = !ok
+			callSiteWrappers.Store(pc, wrapper)
+		}
+		if !wrapper.(bool) {
+			return pc
+		}
+	}
+	return pcs[0]
+}
+
+// Debug logs a message at DebugLevel if the call site is not rate limited.
+func (r Limited) Debug(msg string, fields ...zapcore.Field) {
+	r.Log(zapcore.DebugLevel, msg, fields...)
+}
+
+// Info logs a message at InfoLevel if the call site is not rate limited.
+func (r Limited) Info(msg string, fields ...zapcore.Field) {
+	r.Log(zapcore.InfoLevel, msg, fields...)
+}
+
+// Warn logs a message at WarnLevel if the call site is not rate limited.
+func (r Limited) Warn(msg string, fields ...zapcore.Field) {
+	r.Log(zapcore.WarnLevel, msg, fields...)
+}
+
+// Error logs a message at ErrorLevel if the call site is not rate limited.
+func (r Limited) Error(msg string, fields ...zapcore.Field) {
+	r.Log(zapcore.ErrorLevel, msg, fields...)
+}
+
+// Log 先按等级判断再限频, 等级未开启和被过滤的调用不计入限频, 供封装日志接口使用.
+// 与 Debug 等方法的调用深度相同, caller 为调用封装接口的位置
+func (r Limited) Log(level zapcore.Level, msg string, fields ...zapcore.Field) {
+	base := GetLogger()
+	if base == nil {
+		return
+	}
+	ce := limitedLogger(base).Check(level, msg)
+	if ce == nil {
+		return
+	}
+	n, ok := r.lim.allow()
+	if !ok {
+		return
+	}
+	ce.Write(append(addGoID(fields), Suppressed(n))...)
+}
+
+var limitedCache atomic.Value // namedCache
+
+// limitedLogger 多跳过一层 Limited.Log, caller 为调用 Limited 的位置
+func limitedLogger(base *zap.Logger) *zap.Logger {
+	if c, ok := limitedCache.Load().(namedCache); ok && c.base == base {
+		return c.logger
+	}
+	logger := base.WithOptions(zap.AddCallerSkip(1))
+	limitedCache.Store(namedCache{base: base, logger: logger})
+	return logger
+}
@@ -0,0 +1,115 @@
+package zlog_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyle-hy/zlog"
+	"github.com/kyle-hy/zlog/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+// 调用点按函数判断, 本库包内的测试函数会被当作封装函数跳过, 所以放在外部测试包
+
+type limitedLine struct {
+	Level      string  `json:"level"`
+	Msg        string  `json:"msg"`
+	Caller     string  `json:"caller"`
+	Suppressed *uint64 `json:"suppressed"`
+}
+
+// initLimitedLog info等级, 同步写入path
+func initLimitedLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "limited.log")
+	if err := zlog.InitLog(zlog.InfoLevel(), zlog.Outputs(zlog.Output{URL: path})); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readLimitedLines(t *testing.T, path string) map[string][]uint64 {
+	t.Helper()
+	zlog.Sync()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got := make(map[string][]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var l limitedLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("%q: %v", sc.Text(), err)
+		}
+		if l.Suppressed == nil {
+			t.Fatalf("%q: no suppressed field", sc.Text())
+		}
+		if !strings.HasPrefix(filepath.Base(l.Caller), "ratelimit_test.go:") {
+			t.Errorf("%s: caller %s", l.Msg, l.Caller)
+		}
+		got[l.Msg] = append(got[l.Msg], *l.Suppressed)
+	}
+	return got
+}
+
+func equalCounts(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLimitedSuppressed(t *testing.T) {
+	path := initLimitedLog(t)
+	for i := 0; i < 5; i++ {
+		zlog.FirstN(2).Info("first")
+	}
+	for i := 0; i < 3; i++ {
+		zlog.Every(time.Hour).Warn("every")
+	}
+	for i := 0; i < 7; i++ {
+		zlog.EveryN(3).Info("everyN")
+	}
+	// 等级未开启的调用不计入限频, 其他logger名开启了debug时 Check 仍会过滤
+	zlog.SetNamedLevel("room", zapcore.DebugLevel)
+	defer zlog.UnsetNamedLevel("room")
+	for i := 0; i < 4; i++ {
+		r := zlog.EveryN(2)
+		r.Debug("filtered")
+		r.Info("filtered")
+	}
+	for i := 0; i < 4; i++ {
+		r := logger.EveryN(2)
+		r.Debugf("filtered %d", 0)
+		r.Infof("printf %d", 0)
+	}
+
+	got := readLimitedLines(t, path)
+	want := map[string][]uint64{
+		"first":    {0, 0},
+		"every":    {0},
+		"everyN":   {0, 2, 2},
+		"filtered": {0, 1},
+		"printf 0": {0, 1},
+	}
+	for msg, w := range want {
+		if !equalCounts(got[msg], w) {
+			t.Errorf("%s: suppressed %v, want %v", msg, got[msg], w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("unexpected lines %v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	maxLineSize = 16 * 1024 * 1024 // 读取日志时单行的最大长度
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// logFileReader 日志文件读取器
+type logFileReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close 关闭读取链上的所有reader和文件
+func (r *logFileReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if e := r.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// gzipTailReader 容忍未结束的gzip流
+// 流式压缩的当前文件或进程崩溃留下的文件没有gzip结尾, 读到最后一个刷新点即视为结束
+type gzipTailReader struct {
+	zr *gzip.Reader
+}
+
+func (g *gzipTailReader) Read(p []byte) (int, error) {
+	n, err := g.zr.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// OpenLogFile 打开日志文件读取明文日志, 未加密的文件key传nil.
+// 逐层自动识别lumberjack滚动后gzip压缩的文件、流式压缩的文件和加密的文件
+func OpenLogFile(path string, key []byte) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &logFileReader{closers: []io.Closer{f}}
+
+	var cur io.Reader = f
+	for {
+		br := bufio.NewReader(cur)
+		r.Reader = br
+		magic, err := br.Peek(len(encryptMagic))
+		if err != nil && err != io.EOF {
+			r.Close()
+			return nil, err
+		}
+		switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			zr, err := gzip.NewReader(br)
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			r.closers = append(r.closers, zr)
+			cur = &gzipTailReader{zr}
+		case bytes.Equal(magic, encryptMagic):
+			dr, err := newDecryptReader(br, key)
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			cur = dr
+		case bytes.HasPrefix(magic, encryptMagic[:len(encryptMagic)-1]):
+			// 其他版本的加密格式
+			r.Close()
+			return nil, fmt.Errorf("zlog: unsupported encrypted log format %q", magic)
+		default:
+			return r, nil
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// decodeLine 解析一条json日志, 数字解析为json.Number避免丢失精度
+func decodeLine(line []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	fields := make(map[string]interface{})
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// recordLevel 只解析json日志的level, 解析失败返回InfoLevel
+func recordLevel(line []byte) zapcore.Level {
+	key := []byte(`"` + lineEncoderConfig().LevelKey + `":"`)
+	i := bytes.Index(line, key)
+	if i < 0 {
+		return zapcore.InfoLevel
+	}
+	s := line[i+len(key):]
+	j := bytes.IndexByte(s, '"')
+	if j < 0 {
+		return zapcore.InfoLevel
+	}
+	l, ok := textLevel(string(s[:j]))
+	if !ok {
+		return zapcore.InfoLevel
+	}
+	return l
+}
+
+// recordTime 日志的时间字段, 没有或解析失败时为当前时间
+func recordTime(record map[string]interface{}) time.Time {
+	if s, ok := record[lineEncoderConfig().TimeKey].(string); ok {
+		if t, err := parseLogTime(s); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// lineTime json日志行的时间字段, 不是json时为当前时间
+func lineTime(line []byte) time.Time {
+	record, err := decodeLine(line)
+	if err != nil {
+		return time.Now()
+	}
+	return recordTime(record)
+}
+
+// parseLogTime 解析日志的time字段, 支持默认格式和 K8sKeys 的RFC3339
+func parseLogTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(logTimeLayout, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,326 @@
+package zlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultWatchInterval = 5 * time.Second
+	reloadDrainTimeout   = time.Second // 关闭旧logger前等待进行中的日志写完的最长时间
+)
+
+var (
+	reloadMu   sync.Mutex
+	appConfig  *Config // 当前生效的配置
+	configBase Options // 应用配置前的选项, 配置中删除的字段恢复为该值
+
+	errReloadNotInit = errors.New("zlog: reload before log init")
+)
+
+// WatchConfig 监视配置文件, 每interval检查一次修改时间和大小, 收到SIGHUP时立即重新加载, 返回停止监视的函数.
+// 未通过 InitFromFile 初始化时先应用一次该文件
+func WatchConfig(path string, interval time.Duration) (stop func(), err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("zlog: config: %w", err)
+	}
+	reloadMu.Lock()
+	if appConfig == nil {
+		appConfig, configBase = &Config{}, *loadOptions()
+	}
+	reloadMu.Unlock()
+	if err := ReloadConfig(path); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	done := make(chan struct{})
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		defer signal.Stop(hup)
+		modTime, size := info.ModTime(), info.Size()
+		for {
+			force := false
+			select {
+			case <-done:
+				return
+			case <-hup:
+				force = true
+			case <-t.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // 文件替换过程中
+			}
+			if !force && info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			ReloadConfig(path)
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// ReloadConfig 重新加载配置文件. 等级和源文件规则变化时直接修改; 其余变化时重建输出,
+// 先创建新logger再关闭旧logger, 旧管道中的日志写完后关闭. 每次重新加载记录一条变化的日志, 配置错误时保持原配置
+func ReloadConfig(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		Error("zlog config reload failed", zap.Error(err))
+		return err
+	}
+	if err := applyConfig(cfg); err != nil {
+		Error("zlog config reload failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func applyConfig(cfg *Config) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if GetLogger() == nil || appConfig == nil {
+		return errReloadNotInit
+	}
+
+	fields, changes := diffConfig(appConfig, cfg)
+	if len(changes) == 0 {
+		return nil
+	}
+	opt := configBase
+	cfg.option()(&opt)
+
+	// 等级和源文件规则运行时修改, 其余字段变化时重建输出
+	levelChanged, vmoduleChanged, rebuild := false, false, false
+	for _, f := range fields {
+		switch f {
+		case "level":
+			levelChanged = true
+		case "vmodule":
+			vmoduleChanged = true
+		default:
+			rebuild = true
+		}
+	}
+	if rebuild {
+		if err := rebuildLogger(&opt); err != nil {
+			return err
+		}
+	}
+	if vmoduleChanged {
+		o := *loadOptions()
+		o.vmodule = cfg.VModule
+		appOptions.Store(&o)
+		if err := SetVModule(cfg.VModule); err != nil {
+			return err
+		}
+	}
+	if levelChanged {
+		// 配置中的等级覆盖 SetLevelFor 设置的临时等级
+		levelCtl.mu.Lock()
+		stopLevelRevert()
+		setLevel(opt.level)
+		levelCtl.mu.Unlock()
+	}
+	appConfig = cfg
+	Info("zlog config reloaded", zap.Strings("changes", changes))
+	return nil
+}
+
+// rebuildLogger 用新选项创建logger和审计日志后替换, 等旧logger进行中的日志写完后关闭
+func rebuildLogger(opt *Options) error {
+	prev := loadOptions()
+	next := *opt
+	appOptions.Store(&next) // 输出的工厂函数读取当前选项
+	logger, err := newTeeLogger(&next, appLevel)
+	if err != nil {
+		appOptions.Store(prev)
+		return err
+	}
+
+	oldAudit := GetAuditLogger()
+	auditChanged := opt.audit != prev.audit || opt.auditPath != prev.auditPath ||
+		opt.encoding != prev.encoding || !reflect.DeepEqual(opt.fields, prev.fields)
+	if auditChanged {
+		var audit *AuditLogger
+		if opt.audit {
+			if oldAudit != nil {
+				oldAudit.Close() // 审计日志同步写入, 先关闭再打开同一文件
+			}
+			if audit, err = newAuditLogger(&next); err != nil {
+				logger.Sync()
+				appOptions.Store(prev)
+				appAuditLog.Store((*AuditLogger)(nil))
+				return err
+			}
+		} else if oldAudit != nil {
+			oldAudit.Close()
+		}
+		appAuditLog.Store(audit)
+	}
+
+	old := GetLogger()
+	appInnerLog.Store(logger)
+	retireLogger(old)
+	return nil
+}
+
+// retireLogger 等logger进行中的日志写完后刷新并关闭它的所有输出
+func retireLogger(l *zap.Logger) error {
+	dc, ok := l.Core().(*drainCore)
+	if !ok {
+		return l.Sync()
+	}
+	dc.gate.close(reloadDrainTimeout)
+	err := l.Sync()
+	dc.gate.closeOnce.Do(dc.gate.closeSinks)
+	return err
+}
+
+// drainGate 一个logger进行中的日志条数, 替换logger后等计数归零再关闭旧输出
+type drainGate struct {
+	inflight   int64
+	closed     int32
+	closeSinks func() // 关闭 zap.Open 打开的输出, 如文件和同步的网络连接
+	closeOnce  sync.Once
+}
+
+// close 之后的日志转给当前logger, 等待进行中的日志写完, 最多等待timeout
+func (g *drainGate) close(timeout time.Duration) {
+	atomic.StoreInt32(&g.closed, 1)
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&g.inflight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// drainCore 包在logger的最外层, 从 Check 到 Write 计入进行中的日志.
+// 替换后仍持有旧logger(如 GetLogger、V 的返回值)写的日志转给当前logger, 不会写入已关闭的输出.
+// Check 后未写入的日志(如被 Limited 限频)不减少计数, 关闭时最多等待 reloadDrainTimeout
+type drainCore struct {
+	zapcore.Core
+	gate *drainGate
+	ctx  []zapcore.Field // With 附加的字段, 转给当前logger时重新附加
+}
+
+func newDrainCore(core zapcore.Core, closeSinks func()) zapcore.Core {
+	return &drainCore{Core: core, gate: &drainGate{closeSinks: closeSinks}}
+}
+
+func (c *drainCore) With(fields []zapcore.Field) zapcore.Core {
+	ctx := append(c.ctx[:len(c.ctx):len(c.ctx)], fields...)
+	return &drainCore{Core: c.Core.With(fields), gate: c.gate, ctx: ctx}
+}
+
+func (c *drainCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	atomic.AddInt64(&c.gate.inflight, 1)
+	if atomic.LoadInt32(&c.gate.closed) != 0 {
+		atomic.AddInt64(&c.gate.inflight, -1)
+		cur := GetLogger()
+		if cur == nil {
+			return ce
+		}
+		core := cur.Core()
+		if dc, ok := core.(*drainCore); ok && dc.gate == c.gate {
+			return ce // 已关闭但尚未替换, 如 InitLog 重新初始化的过程中
+		}
+		if len(c.ctx) > 0 {
+			core = core.With(c.ctx)
+		}
+		return core.Check(ent, ce)
+	}
+	ce = c.Core.Check(ent, ce)
+	if ce == nil {
+		atomic.AddInt64(&c.gate.inflight, -1)
+		return nil
+	}
+	// 排在各输出之后, 写完后减少计数
+	return ce.AddCore(ent, drainDone{c.gate})
+}
+
+// drainDone 日志写完后减少进行中的计数
+type drainDone struct {
+	gate *drainGate
+}
+
+func (d drainDone) Enabled(zapcore.Level) bool        { return false }
+func (d drainDone) With([]zapcore.Field) zapcore.Core { return d }
+func (d drainDone) Sync() error                       { return nil }
+func (d drainDone) Check(_ zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+
+func (d drainDone) Write(zapcore.Entry, []zapcore.Field) error {
+	atomic.AddInt64(&d.gate.inflight, -1)
+	return nil
+}
+
+// diffConfig 逐字段对比配置, 返回变化的字段名和 "字段: 旧值 -> 新值" 的描述, 密钥不输出
+func diffConfig(a, b *Config) (fields, changes []string) {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		x, y := configValue(va.Field(i)), configValue(vb.Field(i))
+		if reflect.DeepEqual(x, y) {
+			continue
+		}
+		name := t.Field(i).Tag.Get("yaml")
+		fields = append(fields, name)
+		if name == "encrypt_key" {
+			changes = append(changes, name+": changed")
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, configString(x), configString(y)))
+	}
+	return fields, changes
+}
+
+// configValue 解引用指针, 零值和空列表视为未设置
+func configValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return v.Elem().Interface()
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+	}
+	if v.IsZero() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func configString(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,103 @@
+package zlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 重建输出时旧管道中排队的日志写完后才关闭, 重新加载期间的日志不丢失
+func TestReloadDrainsQueued(t *testing.T) {
+	saved := defaultOptions
+	t.Cleanup(func() {
+		closeLog()
+		defaultOptions, appConfig = saved, nil
+	})
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	cfgPath := filepath.Join(dir, "zlog.yaml")
+	writeConfig := func(v int) {
+		data := fmt.Sprintf("level: info\noverflow: false\noutputs:\n  - url: %s\nfields:\n  v: %d\n", logPath, v)
+		if err := os.WriteFile(cfgPath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(0)
+	if err := InitFromFile(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 4
+	var (
+		wg     sync.WaitGroup
+		stop   int32
+		logged int64
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				Info("queued", zap.Int64("n", atomic.AddInt64(&logged, 1)))
+			}
+		}()
+	}
+	// 每次重新加载前等待新logger写入一些日志
+	waitLogged := func() {
+		for n := atomic.LoadInt64(&logged); atomic.LoadInt64(&logged) < n+100; {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	const reloads = 5
+	for v := 1; v <= reloads; v++ {
+		waitLogged()
+		writeConfig(v)
+		if err := ReloadConfig(cfgPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitLogged()
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	if err := closeLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seen := make(map[int64]bool)
+	versions := make(map[int]bool)
+	sc := newLineScanner(bufio.NewReader(f))
+	for sc.Scan() {
+		var l struct {
+			Msg string `json:"msg"`
+			N   int64  `json:"n"`
+			V   int    `json:"v"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("%q: %v", sc.Text(), err)
+		}
+		if l.Msg == "queued" {
+			seen[l.N] = true
+			versions[l.V] = true
+		}
+	}
+	if len(seen) == 0 || int64(len(seen)) != logged {
+		t.Errorf("logged %d, written %d", logged, len(seen))
+	}
+	if !versions[0] || !versions[reloads] {
+		t.Errorf("fields versions %v, want 0 to %d", versions, reloads)
+	}
+}
@@ -0,0 +1,72 @@
+package zlog
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 共享内存日志环, 文件位于/dev/shm, 由生产者进程创建, 收集进程(cmd/zlogcollect)读取后写入滚动文件.
+// 文件头4096字节, 之后为环形数据区. 每条日志为 uint32长度 | 内容, 按8字节对齐,
+// 数据区尾部放不下时写入填充标记后回到开头. 写位置和读位置单调递增, 生产者写完内容后再更新写位置,
+// 进程崩溃时未提交的日志不可见, 已提交的日志留在共享内存中由收集进程继续读取.
+const (
+	ringMagic             = "ZLR1"
+	ringHeaderSize        = 4096
+	ringDefaultSize       = 64 // MB
+	ringDefaultTimeout    = time.Second
+	ringHeartbeatInterval = 100 * time.Millisecond
+	ringPadMarker         = 0xffffffff
+	ringMaxName           = 255
+
+	// 文件头各字段的偏移, 读写位置各占一个cache line
+	ringOffMagic     = 0
+	ringOffCapacity  = 8
+	ringOffWrite     = 64
+	ringOffRead      = 128
+	ringOffFutex     = 192 // 唤醒收集进程的futex计数
+	ringOffWaiting   = 196 // 收集进程是否在等待
+	ringOffHeartbeat = 256 // 收集进程的心跳, unix纳秒
+	ringOffPID       = 320 // 生产者pid
+	ringOffName      = 384 // 生产者进程名, uint32长度 | 内容
+)
+
+// ringConfig 共享内存输出的配置
+type ringConfig struct {
+	path    string
+	size    int
+	timeout time.Duration
+}
+
+func defaultRingPath(name string) string {
+	return "/dev/shm/zlog-" + name + ".ring"
+}
+
+// ringConfigFromURL 读取URL: shm:///dev/shm/x.ring?size=64&timeout=1s, size单位为MB
+func ringConfigFromURL(u *url.URL) (ringConfig, error) {
+	cfg := ringConfig{path: u.Path, size: ringDefaultSize * megabyte, timeout: ringDefaultTimeout}
+	if cfg.path == "" || cfg.path == "/" {
+		cfg.path = defaultRingPath(processName())
+	}
+	q := u.Query()
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 4096 {
+			return cfg, fmt.Errorf("zlog: invalid shm size %q", v)
+		}
+		cfg.size = n * megabyte
+	}
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("zlog: invalid shm timeout %q", v)
+		}
+		cfg.timeout = d
+	}
+	return cfg, nil
+}
+
+func align8(n uint64) uint64 {
+	return (n + 7) &^ 7
+}
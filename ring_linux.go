@@ -0,0 +1,533 @@
+package zlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+const (
+	futexWaitOp = 0 // FUTEX_WAIT, 跨进程共享, 不能用PRIVATE
+	futexWakeOp = 1 // FUTEX_WAKE
+)
+
+// defaultRingFallbackPath 收集进程不在时写入的本地文件, 与收集进程写入的文件分开
+const defaultRingFallbackPath = "./log/%s/%s.shm.log"
+
+var (
+	errRingInvalid = errors.New("zlog: invalid shm ring")
+	errRingOwner   = errors.New("zlog: shm ring is not owned by the current user")
+)
+
+// checkRingOwner 日志环和锁文件位于所有用户可写的/dev/shm, 必须属于当前用户, 其他用户不可读写
+func checkRingOwner(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Uid != uint32(os.Getuid()) {
+		return fmt.Errorf("%w: %s is owned by uid %d", errRingOwner, f.Name(), st.Uid)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		// 旧版本创建的文件
+		return f.Chmod(0600)
+	}
+	return nil
+}
+
+// shmRing 映射到共享内存的日志环, 一个生产者进程和一个收集进程
+type shmRing struct {
+	file     *os.File
+	mem      []byte
+	data     []byte
+	capacity uint64
+}
+
+func (r *shmRing) u64(off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&r.mem[off]))
+}
+
+func (r *shmRing) u32(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r.mem[off]))
+}
+
+// openShmRing 打开日志环. create为true时由生产者调用, 已有的环大小一致则沿用(保留未读的日志), 否则重建
+func openShmRing(path string, size int, create bool) (*shmRing, error) {
+	if r, err := mapShmRing(path); err == nil {
+		if !create || r.capacity == uint64(size) {
+			return r, nil
+		}
+		r.close()
+	} else if !create || errors.Is(err, errRingOwner) {
+		return nil, err
+	}
+
+	// 删除后重建, 仍映射旧文件的收集进程不会访问到截断的内存
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(int64(ringHeaderSize + size)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, ringHeaderSize+size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(mem[ringOffCapacity:], uint64(size))
+	copy(mem[ringOffMagic:], ringMagic)
+	return &shmRing{file: f, mem: mem, data: mem[ringHeaderSize:], capacity: uint64(size)}, nil
+}
+
+// mapShmRing 映射已有的日志环
+func mapShmRing(path string) (*shmRing, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRingOwner(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() <= ringHeaderSize {
+		f.Close()
+		return nil, errRingInvalid
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := &shmRing{file: f, mem: mem, data: mem[ringHeaderSize:]}
+	r.capacity = binary.LittleEndian.Uint64(mem[ringOffCapacity:])
+	if string(mem[ringOffMagic:ringOffMagic+4]) != ringMagic || r.capacity != uint64(len(r.data)) || r.capacity%8 != 0 {
+		r.close()
+		return nil, errRingInvalid
+	}
+	return r, nil
+}
+
+func (r *shmRing) close() {
+	syscall.Munmap(r.mem)
+	r.file.Close()
+}
+
+// setOwner 记录生产者的pid和进程名
+func (r *shmRing) setOwner(name string) {
+	if len(name) > ringMaxName {
+		name = name[:ringMaxName]
+	}
+	atomic.StoreUint64(r.u64(ringOffPID), uint64(os.Getpid()))
+	binary.LittleEndian.PutUint32(r.mem[ringOffName:], uint32(len(name)))
+	copy(r.mem[ringOffName+4:], name)
+}
+
+func (r *shmRing) owner() string {
+	n := binary.LittleEndian.Uint32(r.mem[ringOffName:])
+	if n > ringMaxName {
+		return ""
+	}
+	return string(r.mem[ringOffName+4 : ringOffName+4+int(n)])
+}
+
+// push 写入一条日志, 空间不足返回false. 调用方保证只有一个写入者
+func (r *shmRing) push(p []byte) bool {
+	need := align8(4 + uint64(len(p)))
+	if need > r.capacity/4 {
+		return false
+	}
+	w := atomic.LoadUint64(r.u64(ringOffWrite))
+	used := w - atomic.LoadUint64(r.u64(ringOffRead))
+	off := w % r.capacity
+	var pad uint64
+	if r.capacity-off < need {
+		pad = r.capacity - off
+	}
+	if r.capacity-used < pad+need {
+		return false
+	}
+	if pad > 0 {
+		binary.LittleEndian.PutUint32(r.data[off:], ringPadMarker)
+		w += pad
+		off = 0
+	}
+	binary.LittleEndian.PutUint32(r.data[off:], uint32(len(p)))
+	copy(r.data[off+4:], p)
+	atomic.StoreUint64(r.u64(ringOffWrite), w+need) // 提交
+
+	if atomic.LoadUint32(r.u32(ringOffWaiting)) != 0 {
+		atomic.AddUint32(r.u32(ringOffFutex), 1)
+		futexWake(r.u32(ringOffFutex))
+	}
+	return true
+}
+
+// drain 读出所有已提交的日志, 返回是否读到日志
+func (r *shmRing) drain(fn func(record []byte)) bool {
+	rd := atomic.LoadUint64(r.u64(ringOffRead))
+	w := atomic.LoadUint64(r.u64(ringOffWrite))
+	if rd == w {
+		return false
+	}
+	for rd != w {
+		off := rd % r.capacity
+		n := uint64(binary.LittleEndian.Uint32(r.data[off:]))
+		if n == ringPadMarker {
+			rd += r.capacity - off
+			continue
+		}
+		if off+4+n > r.capacity || w-rd > r.capacity {
+			rd = w // 数据损坏, 丢弃剩余的日志
+			break
+		}
+		fn(r.data[off+4 : off+4+n])
+		rd += align8(4 + n)
+	}
+	atomic.StoreUint64(r.u64(ringOffRead), rd)
+	return true
+}
+
+// wait 等待生产者写入或超时
+func (r *shmRing) wait(timeout time.Duration) {
+	seq := atomic.LoadUint32(r.u32(ringOffFutex))
+	atomic.StoreUint32(r.u32(ringOffWaiting), 1)
+	if atomic.LoadUint64(r.u64(ringOffRead)) == atomic.LoadUint64(r.u64(ringOffWrite)) {
+		futexWait(r.u32(ringOffFutex), seq, timeout)
+	}
+	atomic.StoreUint32(r.u32(ringOffWaiting), 0)
+}
+
+func (r *shmRing) heartbeat() {
+	atomic.StoreUint64(r.u64(ringOffHeartbeat), uint64(time.Now().UnixNano()))
+}
+
+func (r *shmRing) alive(timeout time.Duration) bool {
+	hb := int64(atomic.LoadUint64(r.u64(ringOffHeartbeat)))
+	return time.Since(time.Unix(0, hb)) < timeout
+}
+
+func futexWait(addr *uint32, val uint32, timeout time.Duration) {
+	ts := syscall.NsecToTimespec(int64(timeout))
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), futexWaitOp, uintptr(val), uintptr(unsafe.Pointer(&ts)), 0, 0)
+}
+
+func futexWake(addr *uint32) {
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), futexWakeOp, 1, 0, 0, 0)
+}
+
+// shmSink 定义工厂函数, URL格式:
+//
+//	shm://                               默认 /dev/shm/zlog-进程名.ring
+//	shm:///dev/shm/room.ring?size=64&timeout=1s
+//
+// size 为数据区MB数, timeout 为收集进程心跳超时, 超时后改为进程内的异步文件输出(同 AsyncLog), 心跳恢复后切回.
+// 一个日志环只能有一个生产者, 同一程序的多个实例需要设置不同的路径
+func shmSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := ringConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockShmRing(cfg.path)
+	if err != nil {
+		return nil, err
+	}
+	ring, err := openShmRing(cfg.path, cfg.size, true)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	ring.setOwner(processName())
+
+	s := &shmLogSink{name: u.Redacted(), ring: ring, lock: lock, timeout: cfg.timeout, done: make(chan struct{})}
+	s.check()
+	registerSinkStats(s)
+	s.wg.Add(1)
+	go s.monitor()
+	return s, nil
+}
+
+// lockShmRing 对 path.lock 加文件锁, 保证一个日志环只有一个生产者.
+// 日志环文件本身的锁由收集进程持有
+func lockShmRing(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRingOwner(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("zlog: shm ring %s is used by another process, set a distinct path per instance", path)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// shmLogSink 写共享内存日志环的输出, 写入只有一次内存拷贝, 环满时丢弃并计数
+type shmLogSink struct {
+	name    string
+	ring    *shmRing
+	lock    *os.File // 生产者锁, 关闭时释放
+	timeout time.Duration
+	dropped uint64
+
+	mu       sync.Mutex
+	fallback *AsyncLogSink // 收集进程不在时的进程内输出
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Write 写入日志环, 收集进程不在时写入进程内的异步输出
+func (s *shmLogSink) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return len(p), nil
+	}
+	if s.fallback != nil {
+		return s.fallback.Write(p)
+	}
+	if !s.ring.push(p) {
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// monitor 定时检查收集进程的心跳
+func (s *shmLogSink) monitor() {
+	defer s.wg.Done()
+	t := time.NewTicker(ringHeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.check()
+		}
+	}
+}
+
+// check 按心跳切换日志环和进程内输出
+func (s *shmLogSink) check() {
+	alive := s.ring.alive(s.timeout)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if !alive && s.fallback == nil {
+		opt := *loadOptions()
+		opt.logPath = fmt.Sprintf(defaultRingFallbackPath, processName(), processName())
+		wc, err := newFileWriter(&opt)
+		if err != nil {
+			s.mu.Unlock()
+			fmt.Fprintln(os.Stderr, "zlog: shm fallback:", err)
+			return
+		}
+		s.fallback = newAsyncLogSink(getLogFilePath(&opt), wc, AsyncConfig{Overflow: opt.overflow})
+		s.mu.Unlock()
+		return
+	}
+	var fb *AsyncLogSink
+	if alive && s.fallback != nil {
+		fb, s.fallback = s.fallback, nil
+	}
+	s.mu.Unlock()
+	if fb != nil {
+		fb.Close()
+	}
+}
+
+func (s *shmLogSink) stats() SinkStats {
+	return SinkStats{Name: s.name, Dropped: atomic.LoadUint64(&s.dropped)}
+}
+
+// Sync 同 AsyncLogSink, 关闭输出
+func (s *shmLogSink) Sync() error {
+	return s.Close()
+}
+
+// Close 关闭输出, 日志环中的日志留给收集进程
+func (s *shmLogSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	fb := s.fallback
+	s.fallback = nil
+	s.mu.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+	if fb != nil {
+		fb.Close()
+	}
+	unregisterSinkStats(s)
+	s.ring.close()
+	s.lock.Close()
+	return nil
+}
+
+// RingCollector 共享内存日志环的收集进程, 把日志写入滚动文件
+type RingCollector struct {
+	path string
+	opts []Option
+
+	ring   *shmRing
+	ino    uint64
+	writer *WriteCloseFlusher
+
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewRingCollector 收集path的日志环, opts为文件写入选项,
+// 未设置 LogPath 时写入 ./log/进程名/进程名.log, 进程名为生产者的进程名.
+// 生产者在收集进程不在时写入 ./log/进程名/进程名.shm.log, 两者不会写同一文件
+func NewRingCollector(path string, opts ...Option) *RingCollector {
+	return &RingCollector{path: path, opts: opts, done: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// Run 收集日志直到Close, 日志环不存在时等待生产者创建
+func (c *RingCollector) Run() error {
+	defer func() {
+		if c.writer != nil {
+			c.writer.Close()
+		}
+		close(c.stopped)
+	}()
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-c.done:
+			c.detach()
+			return nil
+		default:
+		}
+
+		if c.ring == nil {
+			if err := c.attach(); err != nil {
+				if errors.Is(err, syscall.EWOULDBLOCK) {
+					return fmt.Errorf("zlog: shm ring %s is locked by another collector", c.path)
+				}
+				if errors.Is(err, errRingOwner) {
+					return err
+				}
+				select {
+				case <-c.done:
+					return nil
+				case <-time.After(ringHeartbeatInterval):
+				}
+				continue
+			}
+		}
+
+		c.ring.heartbeat()
+		if c.ring.drain(func(record []byte) { c.writer.Write(record) }) {
+			c.writer.Flush()
+			continue
+		}
+		if time.Since(lastCheck) >= time.Second {
+			// 生产者重建了日志环, 切换到新文件
+			lastCheck = time.Now()
+			if info, err := os.Stat(c.path); err != nil || fileIno(info) != c.ino {
+				c.detach()
+				continue
+			}
+		}
+		c.ring.wait(ringHeartbeatInterval)
+	}
+}
+
+// attach 映射日志环, 加文件锁保证只有一个收集进程, 首次时打开输出文件
+func (c *RingCollector) attach() error {
+	ring, err := openShmRing(c.path, 0, false)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(ring.file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		ring.close()
+		return err
+	}
+	if c.writer == nil {
+		opt := *loadOptions()
+		for _, o := range c.opts {
+			o(&opt)
+		}
+		if opt.logPath == "" {
+			name := ring.owner()
+			if name == "" {
+				name = "zlog"
+			}
+			opt.logPath = fmt.Sprintf(defaultLogPath, name, name)
+		}
+		w, err := newFileWriter(&opt)
+		if err != nil {
+			ring.close()
+			return err
+		}
+		c.writer = w
+	}
+	info, _ := ring.file.Stat()
+	c.ring, c.ino = ring, fileIno(info)
+	return nil
+}
+
+// detach 读完剩余日志后解除映射
+func (c *RingCollector) detach() {
+	if c.ring == nil {
+		return
+	}
+	c.ring.drain(func(record []byte) { c.writer.Write(record) })
+	c.writer.Flush()
+	c.ring.close()
+	c.ring = nil
+}
+
+// Close 读完日志环中的日志, 关闭输出文件
+func (c *RingCollector) Close() error {
+	c.once.Do(func() { close(c.done) })
+	<-c.stopped
+	return nil
+}
+
+func fileIno(info os.FileInfo) uint64 {
+	if info == nil {
+		return 0
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package zlog
+
+import (
+	"errors"
+	"net/url"
+
+	"go.uber.org/zap"
+)
+
+var errRingUnsupported = errors.New("zlog: shm ring requires linux")
+
+// shmSink 共享内存日志环依赖futex, 只支持linux
+func shmSink(u *url.URL) (zap.Sink, error) {
+	return nil, errRingUnsupported
+}
+
+// RingCollector 共享内存日志环的收集进程, 只支持linux
+type RingCollector struct{}
+
+// NewRingCollector 收集path的日志环
+func NewRingCollector(path string, opts ...Option) *RingCollector {
+	return &RingCollector{}
+}
+
+// Run 非linux平台返回错误
+func (c *RingCollector) Run() error {
+	return errRingUnsupported
+}
+
+// Close 关闭收集
+func (c *RingCollector) Close() error {
+	return nil
+}
@@ -0,0 +1,183 @@
+package zlog
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultSampleTick 按消息采样未指定间隔时的默认值
+const defaultSampleTick = time.Second
+
+// 采样丢弃的条数, 重建logger后继续累加
+var sampledCount, keySampledCount uint64
+
+// newSamplerCore 按消息采样, 每tick内同一等级同一消息的前first条输出, 之后每thereafter条输出一条, first<=0时不采样.
+// zap的采样只统计debug到fatal, 低于debug的等级(trace、V(n))按debug等级在单独的计数中采样
+func newSamplerCore(core zapcore.Core, opt *Options) zapcore.Core {
+	if opt.sampleFirst <= 0 {
+		return core
+	}
+	tick := opt.sampleTick
+	if tick <= 0 {
+		tick = defaultSampleTick
+	}
+	hook := zapcore.SamplerHook(func(_ zapcore.Entry, dec zapcore.SamplingDecision) {
+		if dec&zapcore.LogDropped != 0 {
+			atomic.AddUint64(&sampledCount, 1)
+		}
+	})
+	return &samplerCore{
+		Core:     core,
+		probe:    zapcore.NewSamplerWithOptions(sampleProbe{}, tick, opt.sampleFirst, opt.sampleThereafter, hook),
+		subProbe: zapcore.NewSamplerWithOptions(sampleProbe{}, tick, opt.sampleFirst, opt.sampleThereafter, hook),
+	}
+}
+
+// samplerCore 由zap的采样判断是否输出, 输出时交给内层. 所有低于debug的等级共用一组计数
+type samplerCore struct {
+	zapcore.Core              // 采样前的core
+	probe        zapcore.Core // 只做采样判断, 计数与 With 得到的core共用
+	subProbe     zapcore.Core // 低于debug的等级的采样判断
+}
+
+func (c *samplerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplerCore{Core: c.Core.With(fields), probe: c.probe, subProbe: c.subProbe}
+}
+
+func (c *samplerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Core.Enabled(ent.Level) || !c.sampled(ent) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// writeEnabled 同 Check 后写入
+func (c *samplerCore) writeEnabled(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.Core.Enabled(ent.Level) || !c.sampled(ent) {
+		return nil
+	}
+	return writeEnabled(c.Core, ent, fields)
+}
+
+// sampled 计入采样计数, 返回是否输出
+func (c *samplerCore) sampled(ent zapcore.Entry) bool {
+	probe := c.probe
+	if ent.Level < zapcore.DebugLevel {
+		probe = c.subProbe
+		ent.Level = zapcore.DebugLevel
+	}
+	ce := probe.Check(ent, nil)
+	if ce == nil {
+		return false
+	}
+	ce.Write() // 放回对象池, sampleProbe 不输出
+	return true
+}
+
+// sampleProbe 接受所有日志但不输出, 用于取得采样的判断结果
+type sampleProbe struct{}
+
+func (sampleProbe) Enabled(zapcore.Level) bool                 { return true }
+func (p sampleProbe) With([]zapcore.Field) zapcore.Core        { return p }
+func (sampleProbe) Write(zapcore.Entry, []zapcore.Field) error { return nil }
+func (sampleProbe) Sync() error                                { return nil }
+func (p sampleProbe) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, p)
+}
+
+// hashSampleCore 按字段值的一致性哈希采样, 同一个值要么全部输出要么全部丢弃, 不带该字段的日志不采样,
+// error以上的日志未开启 HashSampleErrors 时不采样. With 带有该字段时在 Check 中判断, 否则在 Write 时按日志调用的字段判断
+type hashSampleCore struct {
+	zapcore.Core
+	key       string
+	threshold uint64 // 哈希值小于threshold时输出
+	errors    bool   // error以上的日志也采样
+	ctxValue  string // With 附加的采样字段的值
+	hasValue  bool
+}
+
+// newHashSampleCore rate为输出的比例, 不在(0, 1)内时不采样
+func newHashSampleCore(core zapcore.Core, opt *Options) zapcore.Core {
+	if opt.hashSampleKey == "" || opt.hashSampleRate <= 0 || opt.hashSampleRate >= 1 {
+		return core
+	}
+	return &hashSampleCore{Core: core, key: opt.hashSampleKey, threshold: uint64(opt.hashSampleRate * math.MaxUint32), errors: opt.hashSampleErrors}
+}
+
+func (c *hashSampleCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	if v, ok := c.value(fields); ok {
+		clone.ctxValue, clone.hasValue = v, true
+	}
+	return &clone
+}
+
+func (c *hashSampleCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if (!c.errors && ent.Level >= zapcore.ErrorLevel) || (c.hasValue && c.keep(c.ctxValue)) {
+		return c.Core.Check(ent, ce)
+	}
+	if !c.Core.Enabled(ent.Level) {
+		return ce
+	}
+	if c.hasValue {
+		atomic.AddUint64(&keySampledCount, 1)
+		return ce
+	}
+	return ce.AddCore(ent, c)
+}
+
+// writeEnabled 同 Check 后写入
+func (c *hashSampleCore) writeEnabled(ent zapcore.Entry, fields []zapcore.Field) error {
+	if (!c.errors && ent.Level >= zapcore.ErrorLevel) || (c.hasValue && c.keep(c.ctxValue)) {
+		return writeEnabled(c.Core, ent, fields)
+	}
+	if !c.Core.Enabled(ent.Level) {
+		return nil
+	}
+	if c.hasValue {
+		atomic.AddUint64(&keySampledCount, 1)
+		return nil
+	}
+	return c.Write(ent, fields)
+}
+
+func (c *hashSampleCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if v, ok := c.value(fields); ok && !c.keep(v) {
+		atomic.AddUint64(&keySampledCount, 1)
+		return nil
+	}
+	// 经过内层的判断, 保持按消息采样和各输出自己的等级
+	return writeEnabled(c.Core, ent, fields)
+}
+
+// value 字段中采样字段的值
+func (c *hashSampleCore) value(fields []zapcore.Field) (string, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == c.key {
+			return fieldValueString(fields[i])
+		}
+	}
+	return "", false
+}
+
+// keep 按值的fnv哈希判断是否输出, 设置了字段值等级的值总是输出
+func (c *hashSampleCore) keep(v string) bool {
+	if uint64(fnv32a(v)) < c.threshold {
+		return true
+	}
+	return loadFieldLevels().has(c.key, v)
+}
+
+// fnv32a FNV-1a哈希, 同 hash/fnv 但不分配内存
+func fnv32a(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
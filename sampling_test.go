@@ -0,0 +1,85 @@
+package zlog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newHashSampleTest(errors bool) (zapcore.Core, *observer.ObservedLogs) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	opt := defaultOptions
+	opt.hashSampleKey, opt.hashSampleRate, opt.hashSampleErrors = logCommonKeyUID, 0.3, errors
+	return newHashSampleCore(obs, &opt), logs
+}
+
+func writeEntry(core zapcore.Core, l zapcore.Level, fields ...zapcore.Field) {
+	if ce := core.Check(zapcore.Entry{Level: l, Message: "enter room"}, nil); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// 同一个uid的日志要么全部输出要么全部丢弃, 输出的uid比例接近rate
+func TestHashSampleConsistent(t *testing.T) {
+	core, logs := newHashSampleTest(false)
+	const uids = 2000
+	for uid := uint64(0); uid < uids; uid++ {
+		writeEntry(core, zapcore.InfoLevel, zap.Uint64(logCommonKeyUID, uid))
+		writeEntry(core.With([]zapcore.Field{zap.Uint64(logCommonKeyUID, uid)}), zapcore.InfoLevel)
+		writeEntry(core, zapcore.DebugLevel, zap.String("room", "r1"), zap.Uint64(logCommonKeyUID, uid))
+	}
+
+	counts := make(map[uint64]int)
+	for _, e := range logs.TakeAll() {
+		counts[uint64(e.ContextMap()[logCommonKeyUID].(uint64))]++
+	}
+	for uid, n := range counts {
+		if n != 3 {
+			t.Errorf("uid %d: %d of 3 entries written", uid, n)
+		}
+	}
+	if rate := float64(len(counts)) / uids; math.Abs(rate-0.3) > 0.05 {
+		t.Errorf("kept %d of %d uids, rate %.3f, want about 0.3", len(counts), uids, rate)
+	}
+
+	// 不带uid的日志不采样
+	writeEntry(core, zapcore.InfoLevel, zap.String("room", "r1"))
+	if n := logs.Len(); n != 1 {
+		t.Errorf("entry without uid: %d written", n)
+	}
+}
+
+func TestHashSampleErrorsAndFieldLevel(t *testing.T) {
+	core, logs := newHashSampleTest(false)
+	// 找一个被采样丢弃的uid
+	var uid uint64
+	for core.(*hashSampleCore).keep(strconv.FormatUint(uid, 10)) {
+		uid++
+	}
+	field := zap.Uint64(logCommonKeyUID, uid)
+
+	writeEntry(core, zapcore.InfoLevel, field)
+	writeEntry(core, zapcore.ErrorLevel, field)
+	if got := logs.TakeAll(); len(got) != 1 || got[0].Level != zapcore.ErrorLevel {
+		t.Errorf("error entries are not sampled by default: %v", got)
+	}
+
+	core, logs = newHashSampleTest(true)
+	writeEntry(core, zapcore.ErrorLevel, field)
+	if n := logs.Len(); n != 0 {
+		t.Errorf("HashSampleErrors: %d error entries written", n)
+	}
+
+	// 设置了字段值等级的uid总是输出
+	SetFieldLevel(logCommonKeyUID, strconv.FormatUint(uid, 10), zapcore.DebugLevel, time.Minute)
+	defer UnsetFieldLevel(logCommonKeyUID, strconv.FormatUint(uid, 10))
+	writeEntry(core, zapcore.InfoLevel, field)
+	if n := logs.Len(); n != 1 {
+		t.Errorf("uid with field level: %d written", n)
+	}
+}
@@ -0,0 +1,44 @@
+package zlog
+
+import (
+	"net/url"
+
+	"go.uber.org/zap"
+)
+
+var registerErr error
+
+// sinkFactories 自定义的zap Sink, key为URL的协议名
+var sinkFactories = map[string]func(*url.URL) (zap.Sink, error){
+	"AsyncLog":     AsyncLoggerSink,
+	"syslog+udp":   syslogSink,
+	"syslog+tcp":   syslogSink,
+	"syslog+unix":  syslogSink,
+	"bulk+http":    httpSink,
+	"bulk+https":   httpSink,
+	"otlp+http":    httpSink,
+	"otlp+https":   httpSink,
+	"fluent+tcp":   fluentSink,
+	"fluent+unix":  fluentSink,
+	"gelf+udp":     gelfSink,
+	"gelf+tcp":     gelfSink,
+	"journald":     journaldSink,
+	"async+stdout": asyncSink,
+	"async+stderr": asyncSink,
+	"async+file":   asyncSink,
+	"zlogd":        zlogdSink,
+	"shm":          shmSink,
+}
+
+// registerSinks 将自定义Sink的工厂函数注册到zap中, 只注册一次
+func registerSinks() error {
+	initOnce.Do(func() {
+		for scheme, factory := range sinkFactories {
+			if err := zap.RegisterSink(scheme, factory); err != nil {
+				registerErr = err
+				return
+			}
+		}
+	})
+	return registerErr
+}
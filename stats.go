@@ -0,0 +1,64 @@
+package zlog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SinkStats 一个输出的统计
+type SinkStats struct {
+	Name     string // 输出的文件路径或URL
+	Overflow uint64 // 异步管道溢出丢弃的条数, 需开启 Overflow
+	Dropped  uint64 // 输出自身丢弃的条数, 如断线、超长、发送失败
+}
+
+// LogStats 日志统计
+type LogStats struct {
+	Sinks      []SinkStats
+	Sampled    uint64 // 按消息采样丢弃的条数, 见 Sampling
+	KeySampled uint64 // 按字段值采样丢弃的条数, 见 HashSampling
+}
+
+// dropCounter 会丢弃日志的输出实现该接口以上报丢弃条数
+type dropCounter interface {
+	Dropped() uint64
+}
+
+// statsSource 上报统计的输出
+type statsSource interface {
+	stats() SinkStats
+}
+
+var (
+	statsMu    sync.Mutex
+	statsSinks []statsSource
+)
+
+func registerSinkStats(c statsSource) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	statsSinks = append(statsSinks, c)
+}
+
+func unregisterSinkStats(c statsSource) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	for i, s := range statsSinks {
+		if s == c {
+			statsSinks = append(statsSinks[:i], statsSinks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Stats 获取当前各输出的统计
+func Stats() LogStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	s := LogStats{Sampled: atomic.LoadUint64(&sampledCount), KeySampled: atomic.LoadUint64(&keySampledCount)}
+	for _, c := range statsSinks {
+		s.Sinks = append(s.Sinks, c.stats())
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package zlog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syslogRe RFC 5424: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+var syslogRe = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) - - (.*)$`)
+
+func parseSyslog(t *testing.T, msg string) (pri int, ts time.Time, app, body string) {
+	t.Helper()
+	m := syslogRe.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("not RFC 5424: %q", msg)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, m[2])
+	if err != nil {
+		t.Fatalf("timestamp %q: %v", m[2], err)
+	}
+	pri, _ = strconv.Atoi(m[1])
+	return pri, ts, m[4], m[6]
+}
+
+func newTestSyslogWriter(t *testing.T, rawURL string) *syslogWriter {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newSyslogWriter(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w := newTestSyslogWriter(t, "syslog+udp://"+pc.LocalAddr().String()+"?facility=local0&app=room")
+	defer w.Close()
+	line := `{"level":"error","time":"2024-05-06T07:08:09.123456789Z","msg":"enter room"}`
+	w.Write([]byte(line + "\n"))
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pri, ts, app, body := parseSyslog(t, string(buf[:n]))
+	// TIMESTAMP 为日志的时间, 精确到微秒
+	if want := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+	if want := 16*8 + 3; pri != want {
+		t.Errorf("pri = %d, want %d", pri, want)
+	}
+	if app != "room" {
+		t.Errorf("app = %q, want room", app)
+	}
+	if body != line {
+		t.Errorf("msg = %q, want %q", body, line)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	levels := []struct {
+		level    string
+		severity int
+	}{
+		{"trace", 7},
+		{"debug", 7},
+		{"info", 6},
+		{"warn", 4},
+		{"error", 3},
+		{"dpanic", 2},
+		{"panic", 1},
+		{"fatal", 0},
+	}
+	w := newTestSyslogWriter(t, "syslog+tcp://"+ln.Addr().String())
+	for _, l := range levels {
+		w.Write([]byte(`{"level":"` + l.level + `","msg":"line 1\nline 2"}` + "\n"))
+	}
+	w.Flush()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// octet-counting: MSG-LEN SP SYSLOG-MSG
+	r := bufio.NewReader(conn)
+	for _, l := range levels {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+		if err != nil {
+			t.Fatalf("frame length %q: %v", size, err)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		pri, _, _, body := parseSyslog(t, string(msg))
+		if want := syslogDefaultFacility*8 + l.severity; pri != want {
+			t.Errorf("%s: pri = %d, want %d", l.level, pri, want)
+		}
+		if !strings.Contains(body, `"level":"`+l.level+`"`) {
+			t.Errorf("%s: msg = %q", l.level, body)
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("trailing data after frames: %v", err)
+	}
+}
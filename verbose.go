@@ -0,0 +1,122 @@
+package zlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// TraceLevel 低于debug的跟踪等级, 用于包级别的追踪日志, 同 V(2)
+const TraceLevel = zapcore.DebugLevel - 1
+
+// maxVerbosity V(n) 的最大n, 等级不低于 math.MinInt8+1
+const maxVerbosity = 127
+
+// VLevel V(n) 日志的等级: V(0) 为info, V(1) 为debug, V(2) 为trace, n越大等级越低
+func VLevel(n int) zapcore.Level {
+	if n < 0 {
+		n = 0
+	}
+	if n > maxVerbosity {
+		n = maxVerbosity
+	}
+	return zapcore.InfoLevel - zapcore.Level(n)
+}
+
+// Verbose V(n) 的结果, 未开启时调用 Info 不做任何事
+type Verbose struct {
+	logger *zap.Logger // 未开启时为nil
+	level  zapcore.Level
+}
+
+// V glog风格的详细等级, 如 zlog.V(3).Info(...), 全局等级、源文件规则或字段值等级不低于 VLevel(n) 时输出.
+// 参数构造开销大时先判断 if v := zlog.V(3); v.Enabled() {...}, 未初始化时不输出
+func V(n int) Verbose {
+	level := VLevel(n)
+	l := GetLogger()
+	if l == nil || !(appLevel.Enabled(level) || extraEnabled(level)) {
+		return Verbose{level: level}
+	}
+	return Verbose{logger: l, level: level}
+}
+
+// Enabled 是否可能输出, 源文件规则和字段值等级在写日志时按调用点和字段精确判断
+func (v Verbose) Enabled() bool {
+	return v.logger != nil
+}
+
+// Level 日志等级, 同 VLevel(n)
+func (v Verbose) Level() zapcore.Level {
+	return v.level
+}
+
+// Info 以 VLevel(n) 等级写日志
+func (v Verbose) Info(msg string, fields ...zapcore.Field) {
+	if v.logger == nil {
+		return
+	}
+	if ce := v.logger.Check(v.level, msg); ce != nil {
+		ce.Write(addGoID(fields)...)
+	}
+}
+
+// levelString 日志等级的名字, 低于debug时为 trace、v3、v4...
+func levelString(l zapcore.Level) string {
+	switch {
+	case l >= zapcore.DebugLevel:
+		return l.String()
+	case l == TraceLevel:
+		return "trace"
+	}
+	return "v" + strconv.Itoa(int(zapcore.InfoLevel-l))
+}
+
+// capitalLevelString 大写的日志等级名字
+func capitalLevelString(l zapcore.Level) string {
+	if l >= zapcore.DebugLevel {
+		return l.CapitalString()
+	}
+	return strings.ToUpper(levelString(l))
+}
+
+// lowercaseLevelEncoder 同 zapcore.LowercaseLevelEncoder, 支持低于debug的等级
+func lowercaseLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(levelString(l))
+}
+
+// capitalLevelEncoder 同 zapcore.CapitalLevelEncoder, 支持低于debug的等级
+func capitalLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(capitalLevelString(l))
+}
+
+// capitalColorLevelEncoder 同 zapcore.CapitalColorLevelEncoder, 低于debug的等级与debug同色
+func capitalColorLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if l >= zapcore.DebugLevel {
+		zapcore.CapitalColorLevelEncoder(l, enc)
+		return
+	}
+	enc.AppendString(fmt.Sprintf("\x1b[35m%s\x1b[0m", capitalLevelString(l)))
+}
+
+// textLevel 按名字解析日志等级, 不区分大小写, 支持 trace 和 v0 到 v127
+func textLevel(s string) (zapcore.Level, bool) {
+	s = strings.ToLower(s)
+	switch {
+	case s == "trace":
+		return TraceLevel, true
+	case len(s) > 1 && s[0] == 'v':
+		n, err := strconv.Atoi(s[1:])
+		if err != nil || n < 0 || n > maxVerbosity || s[1] == '+' {
+			return 0, false
+		}
+		return VLevel(n), true
+	}
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, false
+	}
+	return l, true
+}
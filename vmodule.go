@@ -0,0 +1,180 @@
+package zlog
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	vmoduleNone    = zapcore.FatalLevel + 1      // 没有匹配规则的调用点
+	vmoduleWrapper = zapcore.Level(math.MinInt8) // zap和本库的封装函数, 继续查找上一层
+)
+
+// vmoduleRule 一条源文件规则, pattern 以 .go 结尾时匹配文件, 否则匹配目录, 按路径末尾的同样段数匹配
+type vmoduleRule struct {
+	pattern string
+	parts   int
+	file    bool
+	level   zapcore.Level
+}
+
+// vmoduleState 一组规则和按调用点PC缓存的结果, 修改规则时整体替换
+type vmoduleState struct {
+	spec  string
+	rules []vmoduleRule
+	min   zapcore.Level
+	cache sync.Map // pc -> zapcore.Level, 含 vmoduleWrapper
+}
+
+var vmodule atomic.Value // *vmoduleState
+
+// SetVModule 设置按源文件提高等级的规则, 如 "room/*.go=debug,gateway/conn.go=debug,match=debug",
+// 匹配的调用点在全局和logger等级之外额外输出该等级以上的日志, 空字符串清除规则
+func SetVModule(spec string) error {
+	s, err := parseVModule(spec)
+	if err != nil {
+		return err
+	}
+	vmodule.Store(s)
+	return nil
+}
+
+// GetVModule 当前的源文件规则
+func GetVModule() string {
+	if s := loadVModule(); s != nil {
+		return s.spec
+	}
+	return ""
+}
+
+func loadVModule() *vmoduleState {
+	s, _ := vmodule.Load().(*vmoduleState)
+	return s
+}
+
+func parseVModule(spec string) (*vmoduleState, error) {
+	s := &vmoduleState{spec: spec, min: vmoduleNone}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndexByte(item, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("zlog: vmodule %q: want pattern=level", item)
+		}
+		pattern := strings.Trim(strings.TrimSpace(item[:i]), "/")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("zlog: vmodule %q: %w", item, err)
+		}
+		l, err := parseLevel(item[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("zlog: vmodule %q: %w", item, err)
+		}
+		s.rules = append(s.rules, vmoduleRule{
+			pattern: pattern,
+			parts:   strings.Count(pattern, "/") + 1,
+			file:    strings.HasSuffix(pattern, ".go"),
+			level:   l,
+		})
+		if l < s.min {
+			s.min = l
+		}
+	}
+	return s, nil
+}
+
+// enabled 规则是否可能输出该等级, 没有规则时为false
+func (s *vmoduleState) enabled(l zapcore.Level) bool {
+	return s != nil && l >= s.min
+}
+
+// callerLevel 调用点的等级. Check 时zap尚未得到调用点, 跳过zap和本库的封装函数找到调用日志接口的函数,
+// 与 callerEncoder 输出的调用点相同, 按PC缓存匹配结果, 热路径上只有一次 runtime.Callers 和缓存查找
+func (s *vmoduleState) callerLevel() zapcore.Level {
+	// 栈回溯的开销与帧数成正比, 先取调用日志接口常见的深度, 找不到再继续向上
+	var pcs [16]uintptr
+	skip := 3 // 跳过 runtime.Callers、callerLevel、Check
+	for _, size := range []int{4, len(pcs)} {
+		n := runtime.Callers(skip, pcs[:size])
+		for _, pc := range pcs[:n] {
+			l, ok := s.cache.Load(pc)
+			if !ok {
+				l = s.resolve(pc)
+				s.cache.Store(pc, l)
+			}
+			if l.(zapcore.Level) != vmoduleWrapper {
+				return l.(zapcore.Level)
+			}
+		}
+		if n < size {
+			break
+		}
+		skip += n
+	}
+	return vmoduleNone
+}
+
+// resolve 匹配pc所在的源文件, 第一条匹配的规则生效
+func (s *vmoduleState) resolve(pc uintptr) zapcore.Level {
+	frame, ok := callerFrame(pc)
+	if !ok {
+		return vmoduleWrapper
+	}
+	file := strings.ReplaceAll(frame.File, "\\", "/")
+	for _, r := range s.rules {
+		name := file
+		if !r.file {
+			name = path.Dir(file)
+		}
+		if ok, _ := path.Match(r.pattern, lastPathParts(name, r.parts)); ok {
+			return r.level
+		}
+	}
+	return vmoduleNone
+}
+
+// zlogPkg 本库的包路径
+var zlogPkg = reflect.TypeOf(Logger{}).PkgPath()
+
+// isLogWrapper 函数属于zap或本库(含 logger 子包)
+func isLogWrapper(fn string) bool {
+	return strings.HasPrefix(fn, "go.uber.org/zap") ||
+		strings.HasPrefix(fn, zlogPkg+".") ||
+		strings.HasPrefix(fn, zlogPkg+"/logger.")
+}
+
+// callerFrame pc展开内联函数后第一个不属于zap和本库的帧, 都属于时ok为false.
+// 本库的封装函数内联到调用方时, 同一个pc对应封装函数和调用方两帧, 按调用方判断
+func callerFrame(pc uintptr) (frame runtime.Frame, ok bool) {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !isLogWrapper(f.Function) {
+			return f, true
+		}
+		if !more {
+			return f, false
+		}
+	}
+}
+
+// lastPathParts 路径末尾的n段
+func lastPathParts(p string, n int) string {
+	i := len(p)
+	for ; n > 0; n-- {
+		i = strings.LastIndexByte(p[:i], '/')
+		if i < 0 {
+			return p
+		}
+	}
+	return p[i+1:]
+}
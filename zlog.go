@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/v2pro/plz/gls"
@@ -12,13 +13,25 @@ import (
 )
 
 var (
-	appInnerLog *zap.Logger
+	appInnerLog atomic.Value           // *zap.Logger, 重新加载配置时整体替换
+	appAuditLog atomic.Value           // *AuditLogger
+	appOptions  atomic.Value           // *Options, 当前logger使用的选项, 存入后不再修改
+	appLevel    = zap.NewAtomicLevel() // 全局等级, 重新加载配置时直接修改
 	initOnce    sync.Once
 )
 
-// GetLogger  获取 appInnerLog
+// GetLogger  获取 appInnerLog, 未初始化时返回nil
 func GetLogger() *zap.Logger {
-	return appInnerLog
+	l, _ := appInnerLog.Load().(*zap.Logger)
+	return l
+}
+
+// loadOptions 当前logger使用的选项, 未初始化时为默认选项
+func loadOptions() *Options {
+	if o, ok := appOptions.Load().(*Options); ok {
+		return o
+	}
+	return &defaultOptions
 }
 
 // InitLog 初始化日志
@@ -28,73 +41,133 @@ func InitLog(opts ...Option) error {
 	for _, opt := range opts {
 		opt(&defaultOptions)
 	}
+	o := defaultOptions
+	appOptions.Store(&o) // 输出的工厂函数读取当前选项
 
-	innerLog, err := newLogger(&defaultOptions)
+	innerLog, err := newLogger(&o)
 	if err != nil {
 		return err
 	}
-	appInnerLog = innerLog
+	appInnerLog.Store(innerLog)
+
+	if o.audit {
+		auditLog, err := newAuditLogger(&o)
+		if err != nil {
+			return err
+		}
+		appAuditLog.Store(auditLog)
+	}
 	return nil
 }
 
 func closeLog() error {
-	if appInnerLog != nil {
-		return appInnerLog.Sync()
+	if a := GetAuditLogger(); a != nil {
+		a.Close()
+		appAuditLog.Store((*AuditLogger)(nil))
+	}
+	if l := GetLogger(); l != nil {
+		return retireLogger(l)
 	}
 	return nil
 }
 
+// logTimeLayout 日志time字段的格式
+const logTimeLayout = "2006-01-02 15:04:05"
+
 func epochFullTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-	enc.AppendString(t.Format("2006-01-02 15:04:05"))
+	enc.AppendString(t.Format(logTimeLayout))
 }
 
-// newLogger 初始化日志
-func newLogger(opt *Options) (*zap.Logger, error) {
-	// 将AsyncLoggerSink工厂函数注册到zap中, 自定义协议名为 AsyncLog
-	if err := zap.RegisterSink("AsyncLog", AsyncLoggerSink); err != nil {
-		fmt.Println(err)
-		return nil, err
-	}
-	outPaths := []string{"AsyncLog://127.0.0.1"}
-	if opt.stdout {
-		outPaths = append(outPaths, "stdout")
-	}
-
-	logLevel := zap.NewAtomicLevelAt(opt.level)
-	var zc = zap.Config{
-		Level:             logLevel,
-		Development:       false,
-		DisableCaller:     false,
-		DisableStacktrace: false,
-		Sampling:          nil,
-		Encoding:          "json",
-		EncoderConfig: zapcore.EncoderConfig{
-			MessageKey:     "msg",
-			LevelKey:       "level",
-			TimeKey:        "time",
-			NameKey:        "name",
+// newEncoderConfig 日志编码配置, k8sKeys 为true时使用k8s日志采集友好的字段名
+func newEncoderConfig(k8sKeys bool) zapcore.EncoderConfig {
+	if k8sKeys {
+		return zapcore.EncoderConfig{
+			MessageKey:     "message",
+			LevelKey:       "severity",
+			TimeKey:        "timestamp",
+			NameKey:        "logger",
 			CallerKey:      "caller",
 			StacktraceKey:  "stack",
 			LineEnding:     zapcore.DefaultLineEnding,
-			EncodeLevel:    zapcore.LowercaseLevelEncoder,
-			EncodeTime:     epochFullTimeEncoder, // EncodeTime: zapcore.ISO8601TimeEncoder,
+			EncodeLevel:    capitalLevelEncoder,
+			EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
 			EncodeDuration: zapcore.StringDurationEncoder,
 			EncodeCaller:   callerEncoder,
 			EncodeName:     zapcore.FullNameEncoder,
-		},
-		OutputPaths:      outPaths,
-		ErrorOutputPaths: []string{"stderr"},
-		InitialFields:    opt.fields,
+		}
+	}
+	return zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "time",
+		NameKey:        "name",
+		CallerKey:      "caller",
+		StacktraceKey:  "stack",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    lowercaseLevelEncoder,
+		EncodeTime:     epochFullTimeEncoder, // EncodeTime: zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   callerEncoder,
+		EncodeName:     zapcore.FullNameEncoder,
 	}
+}
+
+// lineEncoderConfig 解析json日志行的输出(syslog、gelf、journald、otlp、fluent)使用的编码配置,
+// 不受 K8sKeys 影响, 时间精确到纳秒, 由这些输出按固定的字段名解析
+func lineEncoderConfig() zapcore.EncoderConfig {
+	cfg := newEncoderConfig(false)
+	cfg.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	return cfg
+}
 
-	return zc.Build(zap.AddCallerSkip(1))
+// newLogger 初始化日志
+func newLogger(opt *Options) (*zap.Logger, error) {
+	if err := registerSinks(); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if opt.vmodule != "" {
+		if err := SetVModule(opt.vmodule); err != nil {
+			return nil, err
+		}
+	}
+	appLevel.SetLevel(opt.level)
+	return newTeeLogger(opt, appLevel)
+}
+
+// GetAuditLogger 获取审计日志, 未开启时返回nil
+func GetAuditLogger() *AuditLogger {
+	a, _ := appAuditLog.Load().(*AuditLogger)
+	return a
+}
+
+// Audit 同步写一条审计日志, fsync落盘后返回.
+// 审计日志不经过异步管道, 写失败返回错误, 由调用方决定是否继续处理请求.
+func Audit(msg string, fields ...zapcore.Field) error {
+	a := GetAuditLogger()
+	if a == nil {
+		return errAuditNotInit
+	}
+	return a.log(2, msg, addGoID(fields))
+}
+
+// Trace logs a message at TraceLevel. The message includes any fields passed
+// at the log site, as well as any fields accumulated on the logger.
+func Trace(msg string, fields ...zapcore.Field) {
+	if l := GetLogger(); l != nil {
+		if ce := l.Check(TraceLevel, msg); ce != nil {
+			ce.Write(addGoID(fields)...)
+		}
+	} else {
+		fmt.Println("log not init. msg:", msg)
+	}
 }
 
 // Debug logs a message at DebugLevel. The message includes any fields passed
 // at the log site, as well as any fields accumulated on the logger.
 func Debug(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Debug(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.Debug(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -103,8 +176,8 @@ func Debug(msg string, fields ...zapcore.Field) {
 // Info logs a message at InfoLevel. The message includes any fields passed
 // at the log site, as well as any fields accumulated on the logger.
 func Info(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Info(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.Info(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -113,8 +186,8 @@ func Info(msg string, fields ...zapcore.Field) {
 // Warn logs a message at WarnLevel. The message includes any fields passed
 // at the log site, as well as any fields accumulated on the logger.
 func Warn(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Warn(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.Warn(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -123,8 +196,8 @@ func Warn(msg string, fields ...zapcore.Field) {
 // Error logs a message at ErrorLevel. The message includes any fields passed
 // at the log site, as well as any fields accumulated on the logger.
 func Error(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Error(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.Error(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -134,9 +207,9 @@ func Error(msg string, fields ...zapcore.Field) {
 // at the log site, as well as any fields accumulated on the logger.
 // The logger then closed and panics, even if logging at PanicLevel is disabled.
 func PanicAsync(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Error("panic:"+msg, addGoID(fields)...)
-		appInnerLog.Sync()
+	if l := GetLogger(); l != nil {
+		l.Error("panic:"+msg, addGoID(fields)...)
+		l.Sync()
 		panic(msg)
 	} else {
 		fmt.Println("log not init. msg:", msg)
@@ -148,9 +221,9 @@ func PanicAsync(msg string, fields ...zapcore.Field) {
 //
 // The logger then calls os.Exit(1), even if logging at FatalLevel is disabled.
 func FatalAsync(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Error("fatal:"+msg, addGoID(fields)...)
-		appInnerLog.Sync()
+	if l := GetLogger(); l != nil {
+		l.Error("fatal:"+msg, addGoID(fields)...)
+		l.Sync()
 		os.Exit(1)
 	} else {
 		fmt.Println("log not init. msg:", msg)
@@ -164,8 +237,8 @@ func FatalAsync(msg string, fields ...zapcore.Field) {
 // "development panic"). This is useful for catching errors that are
 // recoverable, but shouldn't ever happen.
 func DPanic(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.DPanic(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.DPanic(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -176,8 +249,8 @@ func DPanic(msg string, fields ...zapcore.Field) {
 //
 // The logger then panics, even if logging at PanicLevel is disabled.
 func Panic(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Panic(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.Panic(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -188,8 +261,8 @@ func Panic(msg string, fields ...zapcore.Field) {
 //
 // The logger then calls os.Exit(1), even if logging at FatalLevel is disabled.
 func Fatal(msg string, fields ...zapcore.Field) {
-	if appInnerLog != nil {
-		appInnerLog.Fatal(msg, addGoID(fields)...)
+	if l := GetLogger(); l != nil {
+		l.Fatal(msg, addGoID(fields)...)
 	} else {
 		fmt.Println("log not init. msg:", msg)
 	}
@@ -197,19 +270,20 @@ func Fatal(msg string, fields ...zapcore.Field) {
 
 // Sync flush日志到文件，并关闭日志
 func Sync() error {
-	if appInnerLog != nil {
-		return appInnerLog.Sync()
+	if l := GetLogger(); l != nil {
+		return l.Sync()
 	}
 	return nil
 }
 
 // LogLevelEnable returns true if the given level is at or above this level.
 func LogLevelEnable(level zapcore.Level) bool {
-	return appInnerLog.Core().Enabled(level)
+	l := GetLogger()
+	return l != nil && appLevel.Enabled(level) && l.Core().Enabled(level)
 }
 
 func addGoID(fields []zapcore.Field) []zapcore.Field {
-	if defaultOptions.withGID {
+	if loadOptions().withGID {
 		return append(fields, GoID(gls.GoID()))
 	}
 	return fields
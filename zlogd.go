@@ -0,0 +1,303 @@
+package zlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// zlogd 协议: unix socket 上的帧, 每帧为 uint32大端长度 | 类型(1字节) | 内容, 长度包含类型字节.
+// 连接建立后先发送hello帧, 内容为进程名, 之后每条日志一个record帧, 内容为编码后的日志.
+const (
+	agentFrameHello   byte = 'H'
+	agentFrameRecord  byte = 'R'
+	agentMaxFrame          = 16 * 1024 * 1024
+	agentCloseTimeout      = time.Second
+	agentSocketName        = "zlogd.sock"
+)
+
+var errAgentNoHello = errors.New("zlog: zlogd record before hello")
+
+// DefaultAgentSocket zlogd默认监听的unix socket: $XDG_RUNTIME_DIR/zlogd/zlogd.sock,
+// 未设置时root为 /run/zlogd/zlogd.sock, 其他用户为临时目录下的 zlogd-uid/zlogd.sock. 目录权限为0700, 只有同一用户的进程可以连接
+func DefaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "zlogd", agentSocketName)
+	}
+	if os.Getuid() == 0 {
+		return filepath.Join("/run/zlogd", agentSocketName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("zlogd-%d", os.Getuid()), agentSocketName)
+}
+
+// ListenAgent 创建权限0700的socket目录并监听, 删除上次退出残留的socket文件
+func ListenAgent(path string) (net.Listener, error) {
+	if err := prepareAgentDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func appendAgentFrame(b []byte, typ byte, payload []byte) []byte {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(payload)+1))
+	b = append(b, size[:]...)
+	b = append(b, typ)
+	return append(b, payload...)
+}
+
+// readAgentFrame 读取一帧, buf为复用的缓存, 返回的内容在下次读取前有效
+func readAgentFrame(r *bufio.Reader, buf *[]byte) (byte, []byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > agentMaxFrame {
+		return 0, nil, fmt.Errorf("zlog: invalid zlogd frame size %d", n)
+	}
+	if uint32(cap(*buf)) < n {
+		*buf = make([]byte, n)
+	}
+	b := (*buf)[:n]
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return b[0], b[1:], nil
+}
+
+// agentProcessName 进程名作为目录名和文件名, 去掉路径部分
+func agentProcessName(name string) string {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return ""
+	}
+	return name
+}
+
+// AgentConfig zlogd的配置
+type AgentConfig struct {
+	Dir       string   // 日志根目录, 进程的日志写入 Dir/进程名/进程名.log
+	RateLimit float64  // 每个进程每秒最多写入的日志条数, 0为不限制
+	Burst     int      // 限流允许的突发条数, 默认同RateLimit
+	Options   []Option // 文件写入选项, 如 Rotate、Compress、HashChain、Encrypt
+}
+
+// Agent 接收多个进程通过unix socket发送的日志, 按进程名分别写入文件, 沿用本库的文件写入链和滚动
+type Agent struct {
+	cfg AgentConfig
+	opt Options
+
+	mu        sync.Mutex
+	procs     map[string]*agentProcess
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// agentProcess 一个进程的日志文件, 同名进程的多个连接共用
+type agentProcess struct {
+	mu      sync.Mutex
+	writer  *WriteCloseFlusher
+	tokens  float64
+	last    time.Time
+	limited uint64 // 上次写入后限流丢弃的条数, 写入下一条日志的 rateLimited 字段
+}
+
+// NewAgent 创建zlogd
+func NewAgent(cfg AgentConfig) *Agent {
+	opt := *loadOptions()
+	for _, o := range cfg.Options {
+		o(&opt)
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "./log"
+	}
+	if cfg.RateLimit > 0 && cfg.Burst <= 0 {
+		cfg.Burst = int(cfg.RateLimit)
+		if cfg.Burst < 1 {
+			cfg.Burst = 1
+		}
+	}
+	return &Agent{
+		cfg:   cfg,
+		opt:   opt,
+		procs: make(map[string]*agentProcess),
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve 接收连接直到l关闭或Agent关闭
+func (a *Agent) Serve(l net.Listener) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return net.ErrClosed
+	}
+	a.listeners = append(a.listeners, l)
+	a.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			a.mu.Lock()
+			closed := a.closed
+			a.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		a.mu.Lock()
+		if a.closed {
+			a.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		a.conns[conn] = struct{}{}
+		a.wg.Add(1)
+		a.mu.Unlock()
+
+		go func() {
+			defer a.wg.Done()
+			if err := a.handle(conn); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
+				fmt.Fprintln(os.Stderr, "zlogd:", err)
+			}
+		}()
+	}
+}
+
+// handle 读取一个连接的日志, 读缓存为空时Flush
+func (a *Agent) handle(conn net.Conn) error {
+	defer func() {
+		a.mu.Lock()
+		delete(a.conns, conn)
+		a.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, 64*1024)
+	var (
+		proc *agentProcess
+		buf  []byte
+	)
+	for {
+		typ, data, err := readAgentFrame(r, &buf)
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case agentFrameHello:
+			name := agentProcessName(string(data))
+			if name == "" {
+				return fmt.Errorf("zlog: invalid zlogd process name %q", data)
+			}
+			if proc, err = a.process(name); err != nil {
+				return err
+			}
+		case agentFrameRecord:
+			if proc == nil {
+				return errAgentNoHello
+			}
+			proc.write(a.cfg, data, r.Buffered() == 0)
+		}
+	}
+}
+
+// process 获取进程的日志文件, 首次使用时打开
+func (a *Agent) process(name string) (*agentProcess, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if p, ok := a.procs[name]; ok {
+		return p, nil
+	}
+	opt := a.opt
+	opt.logPath = filepath.Join(a.cfg.Dir, name, name+".log")
+	w, err := newFileWriter(&opt)
+	if err != nil {
+		return nil, err
+	}
+	p := &agentProcess{writer: w, tokens: float64(a.cfg.Burst), last: time.Now()}
+	a.procs[name] = p
+	return p, nil
+}
+
+// write 限流后写入一条日志
+func (p *agentProcess) write(cfg AgentConfig, record []byte, flush bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cfg.RateLimit > 0 {
+		now := time.Now()
+		p.tokens += now.Sub(p.last).Seconds() * cfg.RateLimit
+		if p.tokens > float64(cfg.Burst) {
+			p.tokens = float64(cfg.Burst)
+		}
+		p.last = now
+		if p.tokens < 1 {
+			p.limited++
+			if flush {
+				p.writer.Flush()
+			}
+			return
+		}
+		p.tokens--
+	}
+
+	if p.limited > 0 {
+		record = addField(p.limited, "rateLimited", append([]byte(nil), record...))
+		p.limited = 0
+	}
+	p.writer.Write(record)
+	if flush {
+		p.writer.Flush()
+	}
+}
+
+// Close 关闭监听和连接, 写完并关闭所有日志文件
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	for _, l := range a.listeners {
+		l.Close()
+	}
+	for conn := range a.conns {
+		// 读完连接中已发送的日志后退出
+		conn.SetReadDeadline(time.Now().Add(agentCloseTimeout))
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+
+	for _, p := range a.procs {
+		p.mu.Lock()
+		p.writer.Flush()
+		p.writer.Close()
+		p.mu.Unlock()
+	}
+	return nil
+}
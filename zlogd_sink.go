@@ -0,0 +1,132 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	agentBatchSize           = 64 * 1024               // 超过该字节数立即发送
+	defaultAgentFallbackPath = "./log/%s/%s.zlogd.log" // zlogd不可用时写入的本地文件
+)
+
+// zlogdSink 定义工厂函数, URL格式:
+//
+//	zlogd://                       默认 DefaultAgentSocket()
+//	zlogd:///run/zlogd/zlogd.sock
+//
+// 日志发送给本机的zlogd, socket不属于当前用户或root时不连接. 连接不上或发送失败时写入本地文件
+// ./log/进程名/进程名.zlogd.log, 与zlogd写入的文件区分, 重连成功后切回zlogd
+func zlogdSink(u *url.URL) (zap.Sink, error) {
+	cfg, err := asyncConfigFromURL(u)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Path
+	if path == "" || path == "/" {
+		path = DefaultAgentSocket()
+	}
+	nc := newNetConn(path, "unix")
+	nc.check = checkAgentSocket
+	w := &agentClient{nc: nc, hello: appendAgentFrame(nil, agentFrameHello, []byte(processName()))}
+	return newAsyncLogSink(u.Redacted(), &WriteCloseFlusher{Writer: w, Closer: w, Flusher: w}, cfg), nil
+}
+
+// agentClient zlogd客户端, 由异步写协程调用
+// 未发送成功的日志保留在lines中, 发送失败时转写本地文件
+type agentClient struct {
+	nc        *netConn
+	hello     []byte
+	helloConn net.Conn // 已发送hello的连接
+	batch     []byte
+	lines     [][]byte
+	local     *WriteCloseFlusher // 本地文件, 首次需要时打开
+	dropped   uint64
+	warnOnce  sync.Once
+}
+
+// Write p 为一条日志, 由异步管道拷贝后独占
+func (c *agentClient) Write(p []byte) (n int, err error) {
+	conn, err := c.nc.get()
+	if err != nil {
+		if err != errNotConnected && !os.IsNotExist(err) && !errors.Is(err, syscall.ECONNREFUSED) {
+			c.warnOnce.Do(func() { fmt.Fprintln(os.Stderr, "zlog: zlogd unavailable, writing local file:", err) })
+		}
+		c.writeLocal(p)
+		return len(p), nil
+	}
+	if conn != c.helloConn {
+		c.batch = append(c.batch[:0], c.hello...)
+		c.helloConn = conn
+	}
+	c.batch = appendAgentFrame(c.batch, agentFrameRecord, p)
+	c.lines = append(c.lines, p)
+	if len(c.batch) >= agentBatchSize {
+		c.send()
+	}
+	return len(p), nil
+}
+
+// send 发送当前批次, 失败时断开连接, 批次中的日志写入本地文件
+func (c *agentClient) send() {
+	if len(c.lines) == 0 {
+		return
+	}
+	conn := c.helloConn
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write(c.batch); err != nil {
+		c.nc.reset()
+		c.helloConn = nil
+		for _, line := range c.lines {
+			c.writeLocal(line)
+		}
+	}
+	c.batch = c.batch[:0]
+	c.lines = c.lines[:0]
+}
+
+func (c *agentClient) writeLocal(p []byte) {
+	if c.local == nil {
+		opt := *loadOptions()
+		opt.logPath = fmt.Sprintf(defaultAgentFallbackPath, processName(), processName())
+		w, err := newFileWriter(&opt)
+		if err != nil {
+			atomic.AddUint64(&c.dropped, 1)
+			return
+		}
+		c.local = w
+	}
+	c.local.Write(p)
+}
+
+// Flush 发送当前批次, 刷新本地文件
+func (c *agentClient) Flush() error {
+	c.send()
+	if c.local != nil {
+		c.local.Flush()
+	}
+	return nil
+}
+
+// Dropped 本地文件也无法写入时丢弃的日志条数
+func (c *agentClient) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Close 发送剩余日志, 关闭连接和本地文件
+func (c *agentClient) Close() error {
+	c.Flush()
+	if c.local != nil {
+		c.local.Close()
+	}
+	return c.nc.Close()
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package zlog
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkAgentSocket zlogd的socket必须属于当前用户或root, 避免把日志发给其他用户抢先创建的同名socket
+func checkAgentSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if uid := uint32(os.Getuid()); st.Uid != uid && st.Uid != 0 {
+		return fmt.Errorf("zlog: zlogd socket %s is owned by uid %d, not the current user or root", path, st.Uid)
+	}
+	return nil
+}
+
+// prepareAgentDir 创建socket所在的目录, 权限0700. 已存在的目录必须属于当前用户且其他用户不可访问
+func prepareAgentDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("zlog: zlogd socket dir %s is not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Uid != uint32(os.Getuid()) {
+		return fmt.Errorf("zlog: zlogd socket dir %s is owned by uid %d", dir, st.Uid)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("zlog: zlogd socket dir %s is accessible by other users (mode %04o)", dir, perm)
+	}
+	return nil
+}
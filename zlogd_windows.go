@@ -0,0 +1,13 @@
+package zlog
+
+import "os"
+
+// checkAgentSocket windows不检查socket的属主
+func checkAgentSocket(path string) error {
+	return nil
+}
+
+// prepareAgentDir 创建socket所在的目录
+func prepareAgentDir(dir string) error {
+	return os.MkdirAll(dir, 0700)
+}